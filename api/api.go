@@ -5,6 +5,7 @@ import (
 	"database/sql"
 	"errors"
 	"log"
+	"sync"
 
 	"github.com/lugvitc/whats4linux/internal/cache"
 	"github.com/lugvitc/whats4linux/internal/misc"
@@ -28,8 +29,31 @@ type Api struct {
 	cw           *wa.AppDatabase
 	waClient     *whatsmeow.Client
 	messageStore *store.MessageStore
-	imageCache   *cache.ImageCache
+	mediaCache   *cache.MediaCache
 	us           *socket.UnixSocket
+
+	// historySyncs queues the history sync chunks for runHistorySync, the
+	// event handler doesn't wait for them to be stored
+	historySyncs    []*events.HistorySync
+	historySyncMu   sync.Mutex
+	historySyncWake chan struct{}
+
+	// presences holds the last known presence of contacts, presenceSubs the
+	// contacts we subscribed to since connecting
+	presences    misc.VMap[string, Presence]
+	presenceSubs misc.VMap[string, bool]
+
+	// mediaFetches holds the downloads into the media cache in progress
+	mediaFetches misc.VMap[string, *mediaFetch]
+	// uploads holds the cancel functions of the uploads of SendFile
+	uploads misc.VMap[string, context.CancelFunc]
+	// mediaRetries holds the downloads waiting for the phone to upload their
+	// media again, keyed by message ID
+	mediaRetries misc.VMap[string, chan error]
+
+	// autoDownloadWake wakes the dispatcher of the auto-download workers
+	autoDownloadWake chan struct{}
+	autoDownloadOnce sync.Once
 }
 
 // NewApi creates a new Api application struct
@@ -86,10 +110,20 @@ func (a *Api) Startup(ctx context.Context) {
 	if err != nil {
 		panic(err)
 	}
-	a.imageCache, err = cache.NewImageCache()
+	a.messageStore.SetMentionNames(a.mentionName)
+	a.mediaCache, err = cache.NewMediaCache(settings.GetMediaCacheQuota())
 	if err != nil {
 		panic(err)
 	}
+	a.mediaCache.StartSweeper()
+	a.mediaFetches = misc.NewVMap[string, *mediaFetch]()
+	a.uploads = misc.NewVMap[string, context.CancelFunc]()
+	a.mediaRetries = misc.NewVMap[string, chan error]()
+	a.autoDownloadWake = make(chan struct{}, 1)
+	a.historySyncWake = make(chan struct{}, 1)
+	go a.runHistorySync()
+	a.presences = misc.NewVMap[string, Presence]()
+	a.presenceSubs = misc.NewVMap[string, bool]()
 }
 
 func (a *Api) Login() error {
@@ -122,73 +156,72 @@ func (a *Api) Login() error {
 func (a *Api) mainEventHandler(evt any) {
 	switch v := evt.(type) {
 	case *events.Message:
+		messageID := a.messageStore.ProcessMessageEvent(a.ctx, a.waClient.Store.LIDs, v)
 
-		parsedHTML := a.processMessageText(v.Message)
+		// Handle reactions: they update the reactions of the target message
+		if reactionMsg := v.Message.GetReactionMessage(); reactionMsg != nil {
+			a.emitReaction(v.Info.Chat.String(), reactionMsg.GetKey().GetID(), v.Info.Sender.ToNonAD().String(), reactionMsg.GetText())
+			return
+		}
 
-		// Handle message edits: re-parse the edited content
-		if protoMsg := v.Message.GetProtocolMessage(); protoMsg != nil && protoMsg.GetType() == waE2E.ProtocolMessage_MESSAGE_EDIT {
-			newContent := protoMsg.GetEditedMessage()
-			if newContent != nil {
-				parsedHTML = a.processMessageText(newContent)
+		// Handle message revokes: let the UI replace the message with a tombstone
+		if protoMsg := v.Message.GetProtocolMessage(); protoMsg != nil && protoMsg.GetType() == waE2E.ProtocolMessage_REVOKE {
+			if messageID != "" {
+				revokedMsg, err := a.messageStore.GetDecodedMessage(v.Info.Chat.String(), messageID)
+				if err != nil && !errors.Is(err, sql.ErrNoRows) {
+					log.Println("Failed to get decoded message after revoke:", err)
+				}
+				runtime.EventsEmit(a.ctx, "wa:message_revoked", map[string]any{
+					"chatId":    v.Info.Chat.String(),
+					"messageId": messageID,
+					"message":   revokedMsg,
+					"revokedBy": v.Info.Sender.String(),
+				})
 			}
+			return
 		}
 
-		messageID := a.messageStore.ProcessMessageEvent(a.ctx, a.waClient.Store.LIDs, v, parsedHTML)
-
 		// If a message was processed (inserted or updated), emit the decoded message from DB
 		if messageID != "" {
 			updatedMsg, err := a.messageStore.GetDecodedMessage(v.Info.Chat.String(), messageID)
 			if err == nil {
 				runtime.EventsEmit(a.ctx, "wa:new_message", map[string]any{
-					"chatId":      v.Info.Chat.String(),
-					"message":     updatedMsg,
-					"messageText": parsedHTML, // Text field contains HTML now, but better than nothing or we can use updatedMsg.Text
-					"timestamp":   v.Info.Timestamp.Unix(),
-					"sender":      v.Info.PushName,
+					"chatId":  v.Info.Chat.String(),
+					"message": updatedMsg,
+					"sender":  v.Info.PushName,
 				})
+				if !v.Info.IsFromMe {
+					a.emitUnreadCount(v.Info.Chat.String())
+				}
 			} else if !errors.Is(err, sql.ErrNoRows) {
 				log.Println("Failed to get decoded message after processing:", err)
 			}
 		}
 
-		// Automatically cache images and stickers when they arrive
-		go func() {
-			if v.Message.GetImageMessage() != nil || v.Message.GetStickerMessage() != nil {
-				var data []byte
-				var err error
-				var mime string
-				var width, height int
-
-				if v.Message.GetImageMessage() != nil {
-					data, err = a.waClient.Download(a.ctx, v.Message.GetImageMessage())
-					if err == nil {
-						mime = v.Message.GetImageMessage().GetMimetype()
-						if mime == "" {
-							mime = "image/jpeg"
-						}
-						width = int(v.Message.GetImageMessage().GetWidth())
-						height = int(v.Message.GetImageMessage().GetHeight())
-					}
-				} else if v.Message.GetStickerMessage() != nil {
-					data, err = a.waClient.Download(a.ctx, v.Message.GetStickerMessage())
-					if err == nil {
-						mime = v.Message.GetStickerMessage().GetMimetype()
-						if mime == "" {
-							mime = "image/webp"
-						}
-						width = int(v.Message.GetStickerMessage().GetWidth())
-						height = int(v.Message.GetStickerMessage().GetHeight())
-					}
-				}
+		if messageID != "" {
+			a.queueAutoDownload(&v.Info, v.Message)
+		}
 
-				if err == nil && data != nil {
-					_, cacheErr := a.imageCache.SaveImage(v.Info.ID, data, mime, width, height)
-					if cacheErr != nil {
-					} else {
-					}
-				}
-			}
-		}()
+	case *events.HistorySync:
+		a.queueHistorySync(v)
+
+	case *events.Receipt:
+		a.handleReceipt(v)
+
+	case *events.MediaRetry:
+		a.handleMediaRetry(v)
+
+	case *events.MarkChatAsRead:
+		a.handleMarkChatAsRead(v)
+
+	case *events.Archive, *events.Pin, *events.Mute:
+		a.handleChatStateEvent(v)
+
+	case *events.Presence:
+		a.handlePresence(v)
+
+	case *events.ChatPresence:
+		a.handleChatPresence(v)
 
 	case *events.Picture:
 		go a.GetCachedAvatar(v.JID.String(), true)
@@ -205,6 +238,7 @@ func (a *Api) mainEventHandler(evt any) {
 		// wait here until logged in.
 		a.cw.Initialise(a.waClient)
 		a.waClient.SendPresence(a.ctx, types.PresenceAvailable)
+		a.resetPresence()
 		// Run migration for messages.db
 		err := a.messageStore.MigrateLIDToPN(a.ctx, a.waClient.Store.LIDs)
 		if err != nil {
@@ -213,6 +247,7 @@ func (a *Api) mainEventHandler(evt any) {
 			log.Println("Messages DB migration completed successfully")
 			runtime.EventsEmit(a.ctx, "wa:chat_list_refresh")
 		}
+		a.startAutoDownloads()
 	case *events.Disconnected:
 		a.waClient.SendPresence(a.ctx, types.PresenceUnavailable)
 
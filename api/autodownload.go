@@ -0,0 +1,162 @@
+package api
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	"github.com/lugvitc/whats4linux/internal/misc"
+	"github.com/lugvitc/whats4linux/internal/settings"
+	mtypes "github.com/lugvitc/whats4linux/internal/types"
+	"go.mau.fi/whatsmeow/proto/waE2E"
+	"go.mau.fi/whatsmeow/types"
+)
+
+// autoDownloadRetry is how long the dispatcher waits after failing to read
+// the queue
+const autoDownloadRetry = time.Minute
+
+// autoDownload is a queued download handed to a worker, done is called when
+// it's finished
+type autoDownload struct {
+	messageID string
+	done      func()
+}
+
+// incomingMedia returns the type and size of the media of a message, ok is
+// false when it has none
+func incomingMedia(msg *waE2E.Message) (mediaType mtypes.MediaType, size uint64, ok bool) {
+	switch {
+	case msg.GetImageMessage() != nil:
+		return mtypes.MediaTypeImage, msg.GetImageMessage().GetFileLength(), true
+	case msg.GetVideoMessage() != nil:
+		return mtypes.MediaTypeVideo, msg.GetVideoMessage().GetFileLength(), true
+	case msg.GetAudioMessage() != nil:
+		return mtypes.MediaTypeAudio, msg.GetAudioMessage().GetFileLength(), true
+	case msg.GetDocumentMessage() != nil:
+		return mtypes.MediaTypeDocument, msg.GetDocumentMessage().GetFileLength(), true
+	case msg.GetStickerMessage() != nil:
+		return mtypes.MediaTypeSticker, msg.GetStickerMessage().GetFileLength(), true
+	}
+	return 0, 0, false
+}
+
+// chatClass returns the class of a chat for the auto-download policy
+func (a *Api) chatClass(chat types.JID) settings.ChatClass {
+	state, err := a.cw.FetchChatState(chat.String())
+	if err != nil {
+		log.Println("Failed to get chat state:", err)
+	}
+	switch {
+	case state.Muted(time.Now()):
+		return settings.ChatMuted
+	case chat.Server == types.GroupServer:
+		return settings.ChatGroup
+	default:
+		return settings.ChatContact
+	}
+}
+
+// queueAutoDownload queues the media of an incoming message for download
+// when the auto-download policy allows it
+func (a *Api) queueAutoDownload(info *types.MessageInfo, msg *waE2E.Message) {
+	mediaType, size, ok := incomingMedia(msg)
+	if !ok || !settings.ShouldAutoDownload(mediaType, size, a.chatClass(info.Chat), misc.IsMetered()) {
+		return
+	}
+	err := a.mediaCache.QueueDownload(info.ID)
+	if err != nil {
+		log.Println("Failed to queue auto-download:", err)
+		return
+	}
+	a.wakeAutoDownloads()
+}
+
+// wakeAutoDownloads tells the dispatcher there is work in the queue
+func (a *Api) wakeAutoDownloads() {
+	select {
+	case a.autoDownloadWake <- struct{}{}:
+	default:
+	}
+}
+
+// startAutoDownloads starts the workers draining the download queue. It is
+// called on every connection and starts them only once.
+func (a *Api) startAutoDownloads() {
+	a.autoDownloadOnce.Do(func() {
+		workers := settings.GetAutoDownloadWorkers()
+		jobs := make(chan autoDownload)
+		for range workers {
+			go func() {
+				for job := range jobs {
+					a.runAutoDownload(job.messageID)
+					job.done()
+				}
+			}()
+		}
+		go a.dispatchAutoDownloads(jobs, workers)
+	})
+	a.wakeAutoDownloads()
+}
+
+// dispatchAutoDownloads hands the queued downloads to the workers, one batch
+// at a time so that no download is handed out twice. It idles while the
+// queue is empty or the client is offline.
+func (a *Api) dispatchAutoDownloads(jobs chan<- autoDownload, workers int) {
+	defer close(jobs)
+	for {
+		var queued []string
+		if a.waClient.IsConnected() {
+			var err error
+			queued, err = a.mediaCache.QueuedDownloads(4 * workers)
+			if err != nil {
+				log.Println("Failed to read download queue:", err)
+				select {
+				case <-time.After(autoDownloadRetry):
+				case <-a.ctx.Done():
+					return
+				}
+				continue
+			}
+		}
+
+		if len(queued) == 0 {
+			select {
+			case <-a.autoDownloadWake:
+				continue
+			case <-a.ctx.Done():
+				return
+			}
+		}
+
+		var wg sync.WaitGroup
+		wg.Add(len(queued))
+		for _, messageID := range queued {
+			jobs <- autoDownload{messageID: messageID, done: wg.Done}
+		}
+		wg.Wait()
+	}
+}
+
+// runAutoDownload downloads queued media into the media cache. Downloads
+// failing while offline stay queued, the others are dropped and left to be
+// downloaded when opened.
+func (a *Api) runAutoDownload(messageID string) {
+	if meta, err := a.mediaCache.GetMediaByMessageID(messageID); err != nil || meta == nil {
+		msg, err := a.messageStore.GetMessageWithMediaByID(messageID)
+		if err == nil && msg != nil && msg.Media != nil {
+			err = a.fetchMedia(msg)
+		}
+		if err != nil {
+			if !a.waClient.IsConnected() {
+				return
+			}
+			log.Printf("Failed to auto-download media of %s: %v\n", messageID, err)
+		}
+	}
+
+	err := a.mediaCache.DequeueDownload(messageID)
+	if err != nil {
+		log.Println(err)
+	}
+}
@@ -1,16 +1,27 @@
 package api
 
 import (
+	"cmp"
 	"fmt"
+	"log"
+	"slices"
+	"time"
 
 	"github.com/lugvitc/whats4linux/internal/misc"
+	"github.com/lugvitc/whats4linux/internal/store"
+	"github.com/wailsapp/wails/v2/pkg/runtime"
 	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
 )
 
 type ChatElement struct {
 	LatestMessage string `json:"latest_message"`
 	LatestTS      int64
 	Sender        string
+	UnreadCount   int   `json:"unread_count"`
+	Archived      bool  `json:"archived"`
+	Pinned        bool  `json:"pinned"`
+	MutedUntil    int64 `json:"muted_until"`
 	Contact
 }
 
@@ -18,17 +29,22 @@ var tmpProfileCache = misc.NewVMap[string, string]()
 
 func (a *Api) GetChatList() ([]ChatElement, error) {
 	cmList := a.messageStore.GetChatList()
+	states, err := a.cw.FetchChatStates()
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
 	ce := make([]ChatElement, len(cmList))
 	for i, cm := range cmList {
 		var fc Contact
 		if cm.JID.Server == types.GroupServer {
-			groupInfo, err := a.cw.FetchGroup(cm.JID.String())
-			if err != nil {
-				return nil, err
-			}
 			fc = Contact{
-				JID:      cm.JID.String(),
-				FullName: groupInfo.Name,
+				JID: cm.JID.String(),
+			}
+			// groups we left (e.g. from history sync) aren't in app.db
+			groupInfo, err := a.cw.FetchGroup(cm.JID.String())
+			if err == nil {
+				fc.FullName = groupInfo.Name
 			}
 		} else {
 			contact, err := a.waClient.Store.Contacts.GetContact(a.ctx, cm.JID)
@@ -46,13 +62,27 @@ func (a *Api) GetChatList() ([]ChatElement, error) {
 
 		// todo: remove this later
 		fc.FullName = fmt.Sprintf("%s (%s)", fc.FullName, cm.JID.String())
+		state := states[cm.JID.String()]
+		var mutedUntil int64
+		if state.Muted(now) {
+			mutedUntil = state.MutedUntil
+		}
 		ce[i] = ChatElement{
 			LatestMessage: cm.MessageText,
 			LatestTS:      cm.MessageTime,
 			Sender:        cm.Sender,
+			UnreadCount:   cm.UnreadCount,
+			Archived:      state.Archived,
+			Pinned:        state.Pinned(),
+			MutedUntil:    mutedUntil,
 			Contact:       fc,
 		}
 	}
+
+	// pinned chats first, the most recently pinned on top
+	slices.SortStableFunc(ce, func(x, y ChatElement) int {
+		return cmp.Compare(states[y.JID].PinnedAt, states[x.JID].PinnedAt)
+	})
 	return ce, nil
 }
 
@@ -63,3 +93,77 @@ func (a *Api) SendChatPresence(jid string, cp types.ChatPresence, cpm types.Chat
 	}
 	return a.waClient.SendChatPresence(a.ctx, parsedJid, cp, cpm)
 }
+
+// MarkChatRead sends read receipts for the unread messages of a chat and
+// clears its unread count
+func (a *Api) MarkChatRead(jid string) error {
+	parsedJid, err := types.ParseJID(jid)
+	if err != nil {
+		return err
+	}
+	unread, err := a.messageStore.GetUnreadMessages(jid)
+	if err != nil {
+		return err
+	}
+	if len(unread) == 0 {
+		return nil
+	}
+
+	// receipts for group messages are sent per sender
+	var senders []types.JID
+	bySender := make(map[types.JID][]types.MessageID)
+	for _, msg := range unread {
+		if _, ok := bySender[msg.Sender]; !ok {
+			senders = append(senders, msg.Sender)
+		}
+		bySender[msg.Sender] = append(bySender[msg.Sender], msg.ID)
+	}
+	now := time.Now()
+	for _, sender := range senders {
+		err := a.waClient.MarkRead(a.ctx, bySender[sender], now, parsedJid, sender)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = a.messageStore.MarkChatRead(jid, unread[len(unread)-1].Timestamp)
+	if err != nil {
+		return err
+	}
+	a.emitUnreadCount(jid)
+	return nil
+}
+
+// emitUnreadCount tells the frontend the unread count of a chat changed
+func (a *Api) emitUnreadCount(chatJID string) {
+	count, err := a.messageStore.GetUnreadCount(chatJID)
+	if err != nil {
+		log.Println("Failed to get unread count:", err)
+		return
+	}
+	runtime.EventsEmit(a.ctx, "wa:unread_count", map[string]any{
+		"chatId":      chatJID,
+		"unreadCount": count,
+	})
+}
+
+// handleMarkChatAsRead syncs the read state of a chat changed on another device
+func (a *Api) handleMarkChatAsRead(v *events.MarkChatAsRead) {
+	chat := store.CanonicalJID(a.ctx, a.waClient.Store.LIDs, v.JID).String()
+
+	var err error
+	if v.Action.GetRead() {
+		until := v.Action.GetMessageRange().GetLastMessageTimestamp()
+		if until == 0 {
+			until = v.Timestamp.Unix()
+		}
+		err = a.messageStore.MarkChatRead(chat, until)
+	} else {
+		err = a.messageStore.MarkChatUnread(chat)
+	}
+	if err != nil {
+		log.Println("Failed to sync chat read state:", err)
+		return
+	}
+	a.emitUnreadCount(chat)
+}
@@ -0,0 +1,130 @@
+package api
+
+import (
+	"log"
+	"time"
+
+	"github.com/lugvitc/whats4linux/internal/store"
+	"github.com/lugvitc/whats4linux/internal/wa"
+	"github.com/wailsapp/wails/v2/pkg/runtime"
+	"go.mau.fi/whatsmeow/appstate"
+	"go.mau.fi/whatsmeow/proto/waCommon"
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+	"google.golang.org/protobuf/proto"
+)
+
+// latestMessageKey returns the timestamp and key of the latest message of a
+// chat, zero values when the chat has no stored messages
+func (a *Api) latestMessageKey(chat types.JID) (time.Time, *waCommon.MessageKey) {
+	msgs, err := a.messageStore.GetDecodedMessagesPaged(chat.String(), 0, 1)
+	if err != nil || len(msgs) == 0 {
+		return time.Time{}, nil
+	}
+	info := msgs[0].Info
+	ts, _ := time.Parse(time.RFC3339, info.Timestamp)
+	key := &waCommon.MessageKey{
+		RemoteJID: proto.String(chat.String()),
+		FromMe:    proto.Bool(info.IsFromMe),
+		ID:        proto.String(info.ID),
+	}
+	if chat.Server == types.GroupServer && !info.IsFromMe {
+		key.Participant = proto.String(info.Sender)
+	}
+	return ts, key
+}
+
+// SetChatArchived archives or unarchives a chat, archiving also unpins it
+func (a *Api) SetChatArchived(jid string, archived bool) error {
+	parsedJid, err := types.ParseJID(jid)
+	if err != nil {
+		return err
+	}
+	ts, key := a.latestMessageKey(parsedJid)
+	err = a.waClient.SendAppState(a.ctx, appstate.BuildArchive(parsedJid, archived, ts, key))
+	if err != nil {
+		return err
+	}
+	if archived {
+		err = a.cw.SetChatPinned(jid, 0)
+		if err != nil {
+			return err
+		}
+	}
+	return a.cw.SetChatArchived(jid, archived)
+}
+
+// SetChatPinned pins or unpins a chat
+func (a *Api) SetChatPinned(jid string, pinned bool) error {
+	parsedJid, err := types.ParseJID(jid)
+	if err != nil {
+		return err
+	}
+	err = a.waClient.SendAppState(a.ctx, appstate.BuildPin(parsedJid, pinned))
+	if err != nil {
+		return err
+	}
+	var pinnedAt int64
+	if pinned {
+		pinnedAt = time.Now().Unix()
+	}
+	return a.cw.SetChatPinned(jid, pinnedAt)
+}
+
+// SetChatMuted mutes or unmutes a chat. duration is in seconds, muting with
+// a duration of 0 mutes the chat forever.
+func (a *Api) SetChatMuted(jid string, muted bool, duration int64) error {
+	parsedJid, err := types.ParseJID(jid)
+	if err != nil {
+		return err
+	}
+	muteDuration := time.Duration(duration) * time.Second
+	err = a.waClient.SendAppState(a.ctx, appstate.BuildMute(parsedJid, muted, muteDuration))
+	if err != nil {
+		return err
+	}
+	var mutedUntil int64
+	if muted {
+		mutedUntil = wa.MutedForever
+		if muteDuration > 0 {
+			mutedUntil = time.Now().Add(muteDuration).Unix()
+		}
+	}
+	return a.cw.SetChatMuted(jid, mutedUntil)
+}
+
+// handleChatStateEvent stores the archive, pin and mute changes made on
+// another device
+func (a *Api) handleChatStateEvent(evt any) {
+	var err error
+	switch v := evt.(type) {
+	case *events.Archive:
+		chat := store.CanonicalJID(a.ctx, a.waClient.Store.LIDs, v.JID).String()
+		err = a.cw.SetChatArchived(chat, v.Action.GetArchived())
+	case *events.Pin:
+		chat := store.CanonicalJID(a.ctx, a.waClient.Store.LIDs, v.JID).String()
+		var pinnedAt int64
+		if v.Action.GetPinned() {
+			pinnedAt = v.Timestamp.Unix()
+		}
+		err = a.cw.SetChatPinned(chat, pinnedAt)
+	case *events.Mute:
+		chat := store.CanonicalJID(a.ctx, a.waClient.Store.LIDs, v.JID).String()
+		var mutedUntil int64
+		if v.Action.GetMuted() {
+			mutedUntil = wa.MutedForever
+			// the end timestamp is in milliseconds, -1 for chats muted forever
+			if end := v.Action.GetMuteEndTimestamp(); end > 0 {
+				mutedUntil = end / 1000
+			}
+		}
+		err = a.cw.SetChatMuted(chat, mutedUntil)
+	default:
+		return
+	}
+	if err != nil {
+		log.Println("Failed to sync chat state:", err)
+		return
+	}
+	runtime.EventsEmit(a.ctx, "wa:chat_list_refresh")
+}
@@ -0,0 +1,67 @@
+package api
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/lugvitc/whats4linux/internal/export"
+	"github.com/wailsapp/wails/v2/pkg/runtime"
+	"go.mau.fi/whatsmeow/types"
+)
+
+// chatTitle returns the name of a chat, used to name exports
+func (a *Api) chatTitle(chat types.JID) string {
+	if chat.Server == types.GroupServer {
+		group, err := a.cw.FetchGroup(chat.String())
+		if err == nil && group.Name != "" {
+			return group.Name
+		}
+		return chat.User
+	}
+	contact, err := a.waClient.Store.Contacts.GetContact(a.ctx, chat)
+	if err == nil {
+		for _, name := range []string{contact.FullName, contact.FirstName, contact.PushName} {
+			if name != "" {
+				return name
+			}
+		}
+	}
+	return chat.User
+}
+
+// ExportChat exports a chat in the format selected by opts, a zip archive
+// holding the chat log in the format of the official apps by default. When
+// opts.Path is empty the user is asked where to save the export. It returns
+// the path written to, or an empty string if the user cancelled.
+func (a *Api) ExportChat(jid string, opts export.Options) (string, error) {
+	parsedJid, err := types.ParseJID(jid)
+	if err != nil {
+		return "", err
+	}
+
+	if opts.Title == "" {
+		opts.Title = a.chatTitle(parsedJid)
+	}
+	if opts.Path == "" {
+		homeDir, _ := os.UserHomeDir()
+		ext := opts.Format.Ext()
+		title := strings.ReplaceAll(opts.Title, string(filepath.Separator), "_")
+		opts.Path, err = runtime.SaveFileDialog(a.ctx, runtime.SaveDialogOptions{
+			DefaultDirectory: filepath.Join(homeDir, "Downloads"),
+			DefaultFilename:  "WhatsApp Chat - " + title + ext,
+			Title:            "Export chat",
+			Filters:          []runtime.FileFilter{{DisplayName: "Chat Exports", Pattern: "*" + ext}},
+		})
+		if err != nil || opts.Path == "" {
+			return "", err
+		}
+	}
+
+	exporter := export.New(a.messageStore, a.mediaCache, a.waClient.Store.Contacts, a.waClient.Store.PushName)
+	err = exporter.Export(a.ctx, jid, opts)
+	if err != nil {
+		return "", err
+	}
+	return opts.Path, nil
+}
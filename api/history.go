@@ -0,0 +1,155 @@
+package api
+
+import (
+	"log"
+	"slices"
+
+	"github.com/lugvitc/whats4linux/internal/store"
+	"github.com/wailsapp/wails/v2/pkg/runtime"
+	"go.mau.fi/whatsmeow/proto/waWeb"
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+)
+
+// runHistorySync processes history sync chunks one at a time, in the order
+// they arrived, so that the chat list refresh only happens once every earlier
+// chunk is stored
+func (a *Api) runHistorySync() {
+	for {
+		select {
+		case <-a.historySyncWake:
+		case <-a.ctx.Done():
+			return
+		}
+
+		a.historySyncMu.Lock()
+		chunks := a.historySyncs
+		a.historySyncs = nil
+		a.historySyncMu.Unlock()
+
+		for _, evt := range chunks {
+			a.handleHistorySync(evt)
+		}
+	}
+}
+
+// queueHistorySync hands a history sync chunk to runHistorySync without
+// blocking the event handler, a large initial sync would otherwise hold up
+// every other event until it's stored
+func (a *Api) queueHistorySync(evt *events.HistorySync) {
+	a.historySyncMu.Lock()
+	a.historySyncs = append(a.historySyncs, evt)
+	a.historySyncMu.Unlock()
+
+	select {
+	case a.historySyncWake <- struct{}{}:
+	default:
+	}
+}
+
+// handleHistorySync stores the conversations of a history sync chunk in
+// messages.db and reports the sync progress to the frontend
+func (a *Api) handleHistorySync(evt *events.HistorySync) {
+	data := evt.Data
+	conversations := data.GetConversations()
+
+	var msgs []store.HistoryMessage
+	for _, conv := range conversations {
+		chatJID, err := types.ParseJID(conv.GetID())
+		if err != nil {
+			log.Println("History sync: invalid chat JID:", conv.GetID(), err)
+			continue
+		}
+
+		convStart := len(msgs)
+		for _, hsm := range conv.GetMessages() {
+			webMsg := hsm.GetMessage()
+			// skip stubs (group notifications, call logs...) which carry no message
+			if webMsg.GetMessage() == nil {
+				continue
+			}
+			msgEvt, err := a.waClient.ParseWebMessage(chatJID, webMsg)
+			if err != nil {
+				log.Println("History sync: failed to parse message:", err)
+				continue
+			}
+			msgs = append(msgs, store.HistoryMessage{
+				Info:      msgEvt.Info,
+				Message:   msgEvt.Message,
+				Status:    store.MessageStatusFromWeb(webMsg.GetStatus()),
+				Reactions: a.historyReactions(chatJID, webMsg.GetReactions()),
+			})
+		}
+		markHistoryUnread(msgs[convStart:], int(conv.GetUnreadCount()))
+	}
+
+	inserted, err := a.messageStore.InsertHistoryMessages(a.ctx, a.waClient.Store.LIDs, msgs)
+	if err != nil {
+		log.Println("History sync: failed to store messages:", err)
+	}
+
+	runtime.EventsEmit(a.ctx, "wa:history_sync_progress", map[string]any{
+		"syncType":      data.GetSyncType().String(),
+		"chunk":         data.GetChunkOrder(),
+		"percentage":    data.GetProgress(),
+		"conversations": len(conversations),
+		"messages":      inserted,
+	})
+
+	// chunks without progress are standalone syncs (e.g. on-demand)
+	if data.Progress == nil || data.GetProgress() >= 100 {
+		runtime.EventsEmit(a.ctx, "wa:chat_list_refresh")
+	}
+}
+
+// historyReactions converts the reactions attached to a history sync message
+func (a *Api) historyReactions(chatJID types.JID, reactions []*waWeb.Reaction) []store.Reaction {
+	if len(reactions) == 0 {
+		return nil
+	}
+	result := make([]store.Reaction, 0, len(reactions))
+	for _, r := range reactions {
+		key := r.GetKey()
+		var sender types.JID
+		switch {
+		case key.GetFromMe():
+			if a.waClient.Store.ID == nil {
+				continue
+			}
+			sender = a.waClient.Store.ID.ToNonAD()
+		case key.GetParticipant() != "":
+			var err error
+			sender, err = types.ParseJID(key.GetParticipant())
+			if err != nil {
+				continue
+			}
+		default:
+			sender = chatJID
+		}
+		result = append(result, store.Reaction{
+			SenderID: canonicalUserJID(a.ctx, a.waClient, sender).String(),
+			Emoji:    r.GetText(),
+		})
+	}
+	return result
+}
+
+// markHistoryUnread flags the latest count incoming messages of a
+// conversation as unread
+func markHistoryUnread(msgs []store.HistoryMessage, count int) {
+	if count <= 0 {
+		return
+	}
+	var incoming []*store.HistoryMessage
+	for i := range msgs {
+		if !msgs[i].Info.IsFromMe && msgs[i].Message.GetProtocolMessage() == nil {
+			incoming = append(incoming, &msgs[i])
+		}
+	}
+	slices.SortFunc(incoming, func(a, b *store.HistoryMessage) int {
+		return b.Info.Timestamp.Compare(a.Info.Timestamp)
+	})
+	for _, hm := range incoming[:min(count, len(incoming))] {
+		hm.Unread = true
+	}
+}
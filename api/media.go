@@ -1,7 +1,6 @@
 package api
 
 import (
-	"encoding/base64"
 	"fmt"
 	"io"
 	"log"
@@ -11,44 +10,46 @@ import (
 	"path/filepath"
 
 	"github.com/gen2brain/beeep"
+	"github.com/lugvitc/whats4linux/internal/cache"
+	"github.com/lugvitc/whats4linux/internal/server"
 	"github.com/lugvitc/whats4linux/internal/store"
+	mtypes "github.com/lugvitc/whats4linux/internal/types"
 	"github.com/wailsapp/wails/v2/pkg/runtime"
 	"go.mau.fi/whatsmeow"
 	"go.mau.fi/whatsmeow/types"
 )
 
+// DownloadMedia downloads the media of a message into the media cache, when
+// it isn't cached yet, and returns the URL it is served at
 func (a *Api) DownloadMedia(chatJID string, messageID string) (string, error) {
+	if meta, err := a.mediaCache.GetMediaByMessageID(messageID); err == nil && meta != nil {
+		return server.MediaURL(messageID), nil
+	}
+
 	msg, err := a.messageStore.GetMessageWithMedia(chatJID, messageID)
-	if err != nil || msg == nil {
+	if err != nil || msg == nil || msg.Media == nil {
 		return "", fmt.Errorf("message not found")
 	}
 
-	mime := msg.Media.GetMimetype()
-	width, height := msg.Media.GetDimensions()
-
-	mediaType := msg.Media.GetMediaType()
-	if mediaType == whatsmeow.MediaImage && mime == "" {
-		mime = "image/jpeg"
+	if err := a.fetchMedia(msg); err != nil {
+		return "", err
 	}
-	data, err := a.waClient.Download(a.ctx, msg.Media)
+	return server.MediaURL(messageID), nil
+}
+
+// downloadMedia downloads the media of a message into a temporary file of
+// the media cache and returns it with its mime, width and height
+func (a *Api) downloadMedia(msg *store.ExtendedMessage) (*os.File, string, int, int, error) {
+	f, err := a.mediaCache.CreateTemp()
 	if err != nil {
-		return "", fmt.Errorf("failed to download media: %v", err)
+		return nil, "", 0, 0, err
 	}
-
-	// Save to cache for images and stickers
-	if mediaType == whatsmeow.MediaImage {
-		_, err = a.imageCache.SaveImage(messageID, data, mime, width, height)
-		if err != nil {
-			// Log error but continue
-		}
+	// streamed to disk, documents can be up to maxUploadSize
+	if err := a.waClient.DownloadToFile(a.ctx, msg.Media, f); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return nil, "", 0, 0, err
 	}
-
-	return base64.StdEncoding.EncodeToString(data), nil
-}
-
-// downloadMedia downloads media from a message and returns data, mime, width, height
-func (a *Api) downloadMedia(msg *store.ExtendedMessage) ([]byte, string, int, int, error) {
-	data, err := a.waClient.Download(a.ctx, msg.Media)
 	mime := msg.Media.GetMimetype()
 
 	if mime == "" && msg.Media.GetMediaType() == whatsmeow.MediaImage {
@@ -56,68 +57,171 @@ func (a *Api) downloadMedia(msg *store.ExtendedMessage) ([]byte, string, int, in
 	}
 	width, height := msg.Media.GetDimensions()
 
-	return data, mime, width, height, err
+	return f, mime, width, height, nil
 }
 
-func (a *Api) GetCachedImage(messageID string) (string, error) {
-	// Try to read from cache first
-	data, mime, err := a.imageCache.ReadImageByMessageID(messageID)
-	if err == nil {
-		return fmt.Sprintf("data:%s;base64,%s", mime, base64.StdEncoding.EncodeToString(data)), nil
-	}
+// mediaFetch is a download into the media cache in progress, err is its
+// result once done is closed
+type mediaFetch struct {
+	done chan struct{}
+	err  error
+}
 
-	// Image not in cache, download and cache it
-	msg, err := a.messageStore.GetMessageWithMediaByID(messageID)
-	if err != nil || msg == nil {
-		return "", fmt.Errorf("message not found")
+// fetchOnce runs fetch unless a fetch of the same key is already running, in
+// which case it waits for that one and returns its result instead. The
+// ranged requests of a video player would otherwise all download the same
+// file.
+func (a *Api) fetchOnce(key string, fetch func() error) error {
+	fetches, mu := a.mediaFetches.GetMapWithMutex()
+	mu.Lock()
+	if running, ok := fetches[key]; ok {
+		mu.Unlock()
+		<-running.done
+		return running.err
 	}
+	f := &mediaFetch{done: make(chan struct{})}
+	fetches[key] = f
+	mu.Unlock()
 
-	data, mime, width, height, err := a.downloadMedia(msg)
-	if err != nil {
-		return "", fmt.Errorf("failed to download image: %w", err)
+	defer func() {
+		a.mediaFetches.Delete(key)
+		close(f.done)
+	}()
+	f.err = fetch()
+	return f.err
+}
+
+// fetchMedia downloads the media of a message into the media cache
+func (a *Api) fetchMedia(msg *store.ExtendedMessage) error {
+	return a.fetchOnce(msg.Info.ID, func() error {
+		f, mime, width, height, err := a.downloadMedia(msg)
+		if isMediaExpired(err) {
+			f, mime, width, height, err = a.retryDownload(msg)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to download media: %w", err)
+		}
+
+		_, err = a.mediaCache.SaveMediaFile(msg.Info.ID, f, mime, msg.Media.GetMediaGeneralType(), width, height)
+		if err != nil {
+			return fmt.Errorf("failed to cache media: %w", err)
+		}
+		return nil
+	})
+}
+
+// GetCachedImage returns the URL of the media of a message. The media is
+// downloaded when the URL is first loaded.
+func (a *Api) GetCachedImage(messageID string) (string, error) {
+	if meta, err := a.mediaCache.GetMediaByMessageID(messageID); err == nil && meta != nil {
+		return server.MediaURL(messageID), nil
 	}
 
-	_, err = a.imageCache.SaveImage(messageID, data, mime, width, height)
-	if err != nil {
-		// Don't fail, still return the data
+	msg, err := a.messageStore.GetMessageWithMediaByID(messageID)
+	if err != nil || msg == nil || msg.Media == nil {
+		return "", fmt.Errorf("message not found")
 	}
 
-	return fmt.Sprintf("data:%s;base64,%s", mime, base64.StdEncoding.EncodeToString(data)), nil
+	return server.MediaURL(messageID), nil
 }
 
-// GetCachedImages retrieves multiple cached images by message IDs (batch operation)
-// Returns map of message IDs to data URLs
+// GetCachedImages returns the URLs of the cached media of multiple messages
+// (batch operation). Returns map of message IDs to URLs
 func (a *Api) GetCachedImages(messageIDs []string) (map[string]string, error) {
 	result := make(map[string]string)
-	metas, err := a.imageCache.GetImagesByMessageIDs(messageIDs)
+	metas, err := a.mediaCache.GetMediaByMessageIDs(messageIDs)
 	if err != nil {
 		return nil, err
 	}
 
 	for msgID, meta := range metas {
 		if meta != nil {
-			data, mime, err := a.imageCache.ReadImageByMessageID(msgID)
-			if err == nil {
-				result[msgID] = fmt.Sprintf("data:%s;base64,%s", mime, base64.StdEncoding.EncodeToString(data))
-			}
+			result[msgID] = server.MediaURL(msgID)
 		}
 	}
 
 	return result, nil
 }
 
-// GetCachedAvatar retrieves or downloads and caches an avatar for a JID
+// galleryPageSize is the number of items ListChatMedia returns at once
+const galleryPageSize = 60
+
+// galleryKinds are the tabs of a chat's gallery and the media types they list
+var galleryKinds = map[string][]mtypes.MediaType{
+	"media":     {mtypes.MediaTypeImage, mtypes.MediaTypeVideo},
+	"audio":     {mtypes.MediaTypeAudio},
+	"documents": {mtypes.MediaTypeDocument},
+}
+
+// ListChatMedia returns a page of a chat's gallery, newest first. kind is one
+// of "media" (images and videos), "audio", "documents" or "links". cursor is
+// the NextCursor of the previous page, empty for the first one. Images that
+// are cached come with their URL as thumbnail.
+func (a *Api) ListChatMedia(jid, kind, cursor string) (*store.GalleryPage, error) {
+	if kind == "links" {
+		return a.messageStore.ListChatLinks(jid, cursor, galleryPageSize)
+	}
+	mediaTypes, ok := galleryKinds[kind]
+	if !ok {
+		return nil, fmt.Errorf("unknown gallery kind %q", kind)
+	}
+	page, err := a.messageStore.ListChatMedia(jid, mediaTypes, cursor, galleryPageSize)
+	if err != nil {
+		return nil, err
+	}
+
+	var images []string
+	for _, item := range page.Items {
+		if item.Type == mtypes.MediaTypeImage {
+			images = append(images, item.MessageID)
+		}
+	}
+	cached, err := a.GetCachedImages(images)
+	if err != nil {
+		return nil, err
+	}
+	for i := range page.Items {
+		page.Items[i].Thumbnail = cached[page.Items[i].MessageID]
+	}
+	return page, nil
+}
+
+// GetCachedAvatar returns the URL of the avatar of a JID, downloading and
+// caching it first when it isn't cached or recache is set. It returns an
+// empty URL when there is no avatar.
 func (a *Api) GetCachedAvatar(jid string, recache bool) (string, error) {
+	if !recache {
+		meta, err := a.mediaCache.GetMediaByMessageID("avatar_" + jid)
+		if err == nil && meta != nil {
+			return server.AvatarURL(jid, meta.SHA256[:12]), nil
+		}
+	}
+
+	hash, err := a.cacheAvatar(jid)
+	if err != nil || hash == "" {
+		return "", err
+	}
 
-	// Try to get cached avatar data first
-	data, mime, err := a.imageCache.ReadAvatarByJID(jid)
+	return server.AvatarURL(jid, hash[:12]), nil
+}
 
-	if err == nil && !recache {
-		avatarDataURL := fmt.Sprintf("data:%s;base64,%s", mime, base64.StdEncoding.EncodeToString(data))
-		return avatarDataURL, nil
+// cacheAvatar downloads the avatar of a JID into the media cache and returns
+// its hash, empty when there is no avatar
+func (a *Api) cacheAvatar(jid string) (hash string, err error) {
+	err = a.fetchOnce("avatar_"+jid, func() error {
+		hash, err = a.downloadAvatar(jid)
+		return err
+	})
+	if err == nil && hash == "" {
+		// another fetch of the same avatar was running
+		if meta, _ := a.mediaCache.GetMediaByMessageID("avatar_" + jid); meta != nil {
+			hash = meta.SHA256
+		}
 	}
+	return
+}
 
-	// Avatar not in cache, download and cache it
+func (a *Api) downloadAvatar(jid string) (string, error) {
 	jidParsed, err := types.ParseJID(jid)
 	if err != nil {
 		return "", fmt.Errorf("invalid JID: %w", err)
@@ -128,9 +232,7 @@ func (a *Api) GetCachedAvatar(jid string, recache bool) (string, error) {
 		Preview: false, // Get full resolution
 	})
 	if err != nil || pic == nil {
-		if recache {
-			go a.imageCache.DeleteAvatar(jid)
-		}
+		a.mediaCache.DeleteAvatar(jid)
 		return "", nil // No avatar available
 	}
 
@@ -146,13 +248,13 @@ func (a *Api) GetCachedAvatar(jid string, recache bool) (string, error) {
 	}
 
 	// Read the image data
-	data, err = io.ReadAll(resp.Body)
+	data, err := io.ReadAll(resp.Body)
 	if err != nil {
 		return "", fmt.Errorf("failed to read avatar data: %w", err)
 	}
 
 	// Determine MIME type from response header or image data
-	mime = resp.Header.Get("Content-Type")
+	mime := resp.Header.Get("Content-Type")
 	if mime == "" {
 		// Fallback to detection by file signature
 		mime = "image/jpeg" // Default fallback
@@ -169,16 +271,52 @@ func (a *Api) GetCachedAvatar(jid string, recache bool) (string, error) {
 	}
 
 	// Cache the avatar
-	_, err = a.imageCache.SaveAvatar(jid, data, mime)
+	hash, err := a.mediaCache.SaveAvatar(jid, data, mime)
 	if err != nil {
 		log.Printf("[GetCachedAvatar] Failed to cache avatar for %s: %v", jid, err)
 		return "", fmt.Errorf("failed to cache avatar: %w", err)
 	}
 
-	// Return data URL like message images do
-	avatarDataURL := fmt.Sprintf("data:%s;base64,%s", mime, base64.StdEncoding.EncodeToString(data))
+	return hash, nil
+}
+
+// mediaSource serves the media cache to the asset server
+type mediaSource struct {
+	a *Api
+}
 
-	return avatarDataURL, nil
+// NewMediaSource returns the source of the media and avatar routes of the
+// asset server
+func NewMediaSource(a *Api) server.MediaSource {
+	return mediaSource{a}
+}
+
+func (ms mediaSource) OpenMedia(messageID string) (*os.File, *cache.MediaMeta, error) {
+	f, meta, err := ms.a.mediaCache.OpenMedia(messageID)
+	if f != nil || err != nil {
+		return f, meta, err
+	}
+
+	msg, err := ms.a.messageStore.GetMessageWithMediaByID(messageID)
+	if err != nil || msg == nil || msg.Media == nil {
+		return nil, nil, nil
+	}
+	if err := ms.a.fetchMedia(msg); err != nil {
+		return nil, nil, err
+	}
+	return ms.a.mediaCache.OpenMedia(messageID)
+}
+
+func (ms mediaSource) OpenAvatar(jid string) (*os.File, *cache.MediaMeta, error) {
+	f, meta, err := ms.a.mediaCache.OpenAvatar(jid)
+	if f != nil || err != nil {
+		return f, meta, err
+	}
+
+	if _, err := ms.a.cacheAvatar(jid); err != nil {
+		return nil, nil, err
+	}
+	return ms.a.mediaCache.OpenAvatar(jid)
 }
 
 // GetSelfAvatar retrieves the avatar of the logged-in user
@@ -222,7 +360,7 @@ func getFileExtension(mime string) string {
 
 // DownloadImageToFile downloads an image from cache to the Downloads folder
 func (a *Api) DownloadImageToFile(messageID string) error {
-	data, mime, err := a.imageCache.ReadImageByMessageID(messageID)
+	data, mime, err := a.mediaCache.ReadMediaByMessageID(messageID)
 	if err != nil {
 		return err
 	}
@@ -256,3 +394,13 @@ func (a *Api) DownloadImageToFile(messageID string) error {
 	}()
 	return nil
 }
+
+// GetCacheUsage returns the disk usage of the media cache
+func (a *Api) GetCacheUsage() (cache.Usage, error) {
+	return a.mediaCache.Usage()
+}
+
+// ClearCache deletes every cached media file and avatar
+func (a *Api) ClearCache() error {
+	return a.mediaCache.Clear()
+}
@@ -0,0 +1,158 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/lugvitc/whats4linux/internal/store"
+	"github.com/wailsapp/wails/v2/pkg/runtime"
+	"go.mau.fi/whatsmeow"
+	"go.mau.fi/whatsmeow/proto/waMmsRetry"
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+)
+
+// mediaRetryTimeout is how long a download waits for the phone to upload
+// expired media again
+const mediaRetryTimeout = time.Minute
+
+// states of wa:media_status events
+const (
+	mediaStatusRequesting = "requesting"
+	mediaStatusDone       = "done"
+	mediaStatusFailed     = "failed"
+)
+
+// isMediaExpired reports whether a download failed because the media is no
+// longer on the CDN, which the phone can fix by uploading it again
+func isMediaExpired(err error) bool {
+	return errors.Is(err, whatsmeow.ErrMediaDownloadFailedWith404) ||
+		errors.Is(err, whatsmeow.ErrMediaDownloadFailedWith410)
+}
+
+func (a *Api) emitMediaStatus(chatID, messageID, status string, err error) {
+	data := map[string]any{
+		"chatId":    chatID,
+		"messageId": messageID,
+		"status":    status,
+	}
+	if err != nil {
+		data["error"] = err.Error()
+	}
+	runtime.EventsEmit(a.ctx, "wa:media_status", data)
+}
+
+// retryDownload asks the phone to upload expired media again and downloads
+// it from its new path
+func (a *Api) retryDownload(msg *store.ExtendedMessage) (*os.File, string, int, int, error) {
+	chatID := msg.Info.Chat.String()
+	retried, err := a.requestMediaRetry(msg)
+	if err != nil {
+		a.emitMediaStatus(chatID, msg.Info.ID, mediaStatusFailed, err)
+		return nil, "", 0, 0, err
+	}
+
+	f, mime, width, height, err := a.downloadMedia(retried)
+	if err != nil {
+		a.emitMediaStatus(chatID, msg.Info.ID, mediaStatusFailed, err)
+		return nil, "", 0, 0, err
+	}
+	a.emitMediaStatus(chatID, msg.Info.ID, mediaStatusDone, nil)
+	return f, mime, width, height, nil
+}
+
+// requestMediaRetry sends a media retry receipt to the phone and waits for
+// its answer, handled by handleMediaRetry. It returns the message with the
+// new path of its media. Retries of the same message share one request.
+func (a *Api) requestMediaRetry(msg *store.ExtendedMessage) (*store.ExtendedMessage, error) {
+	err := a.fetchOnce("retry:"+msg.Info.ID, func() error {
+		return a.awaitMediaRetry(msg)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return a.messageStore.GetMessageWithMediaByID(msg.Info.ID)
+}
+
+// awaitMediaRetry sends the media retry receipt of a message and waits for
+// the phone to answer
+func (a *Api) awaitMediaRetry(msg *store.ExtendedMessage) error {
+	done := make(chan error, 1)
+	a.mediaRetries.Set(msg.Info.ID, done)
+	defer a.mediaRetries.Delete(msg.Info.ID)
+
+	info := msg.Info
+	info.IsGroup = info.Chat.Server == types.GroupServer
+	err := a.waClient.SendMediaRetryReceipt(a.ctx, &info, msg.Media.GetMediaKey())
+	if err != nil {
+		return fmt.Errorf("failed to request media from phone: %w", err)
+	}
+	a.emitMediaStatus(info.Chat.String(), info.ID, mediaStatusRequesting, nil)
+
+	select {
+	case err = <-done:
+		return err
+	case <-time.After(mediaRetryTimeout):
+		return fmt.Errorf("phone didn't send the media in time")
+	case <-a.ctx.Done():
+		return a.ctx.Err()
+	}
+}
+
+// handleMediaRetry stores the new path of media the phone uploaded again and
+// hands it to the download waiting for it. The download is finished here when
+// nothing waits anymore.
+func (a *Api) handleMediaRetry(evt *events.MediaRetry) {
+	err := a.applyMediaRetry(evt)
+
+	if done, ok := a.mediaRetries.Get(evt.MessageID); ok {
+		select {
+		case done <- err:
+		default:
+		}
+		return
+	}
+
+	if err != nil {
+		log.Printf("Media retry of %s failed: %v\n", evt.MessageID, err)
+		a.emitMediaStatus(evt.ChatID.String(), evt.MessageID, mediaStatusFailed, err)
+		return
+	}
+	go func() {
+		msg, err := a.messageStore.GetMessageWithMediaByID(evt.MessageID)
+		if err == nil {
+			err = a.fetchMedia(msg)
+		}
+		if err != nil {
+			a.emitMediaStatus(evt.ChatID.String(), evt.MessageID, mediaStatusFailed, err)
+			return
+		}
+		a.emitMediaStatus(evt.ChatID.String(), evt.MessageID, mediaStatusDone, nil)
+	}()
+}
+
+// applyMediaRetry decrypts the answer to a media retry receipt and updates the
+// path of the media
+func (a *Api) applyMediaRetry(evt *events.MediaRetry) error {
+	msg, err := a.messageStore.GetMessageWithMediaByID(evt.MessageID)
+	if err != nil || msg == nil || msg.Media == nil {
+		return fmt.Errorf("message not found")
+	}
+
+	notif, err := whatsmeow.DecryptMediaRetryNotification(evt, msg.Media.GetMediaKey())
+	if err != nil {
+		return fmt.Errorf("failed to decrypt media retry: %w", err)
+	}
+	switch notif.GetResult() {
+	case waMmsRetry.MediaRetryNotification_SUCCESS:
+	case waMmsRetry.MediaRetryNotification_NOT_FOUND:
+		return fmt.Errorf("media is no longer on the phone")
+	default:
+		return fmt.Errorf("phone failed to send the media: %s", notif.GetResult())
+	}
+
+	return a.messageStore.UpdateMediaDirectPath(evt.MessageID, notif.GetDirectPath())
+}
@@ -0,0 +1,118 @@
+package api
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"go.mau.fi/whatsmeow/proto/waE2E"
+	"go.mau.fi/whatsmeow/types"
+)
+
+// mentionAll is the token that mentions every participant of a group
+const mentionAll = "all"
+
+// mentionToken matches the @<number> tokens inserted for mentions, WhatsApp
+// expects the user part of the mentioned JID after the @
+var mentionToken = regexp.MustCompile(`@(\d+|` + mentionAll + `)\b`)
+
+// resolveMentions resolves the mentions of an outgoing message. In groups,
+// @<number> tokens are matched against the participants by phone number or
+// LID and rewritten to the JID the group addresses them by, @all mentions
+// everyone when we are an admin. explicit holds JIDs picked in the UI, they
+// are mentioned as is. Tokens that can't be resolved are left as plain text.
+func (a *Api) resolveMentions(chat types.JID, text string, explicit []string) (string, []string, error) {
+	var mentioned []string
+	seen := make(map[string]bool)
+	mention := func(jid types.JID) {
+		s := jid.ToNonAD().String()
+		if !seen[s] {
+			seen[s] = true
+			mentioned = append(mentioned, s)
+		}
+	}
+
+	for _, s := range explicit {
+		jid, err := types.ParseJID(s)
+		if err != nil {
+			return "", nil, fmt.Errorf("invalid mention %q: %w", s, err)
+		}
+		mention(jid)
+	}
+
+	matches := mentionToken.FindAllStringSubmatchIndex(text, -1)
+	if chat.Server != types.GroupServer || len(matches) == 0 {
+		return text, mentioned, nil
+	}
+
+	group, err := a.waClient.GetGroupInfo(a.ctx, chat)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to get group info: %w", err)
+	}
+
+	isSelf := func(p types.GroupParticipant) bool {
+		own, ownLID := a.waClient.Store.GetJID(), a.waClient.Store.GetLID()
+		return p.JID.User == own.User || p.PhoneNumber.User == own.User || (!ownLID.IsEmpty() && p.LID.User == ownLID.User)
+	}
+	isAdmin := false
+	for _, p := range group.Participants {
+		if isSelf(p) {
+			isAdmin = p.IsAdmin || p.IsSuperAdmin
+			break
+		}
+	}
+
+	var b strings.Builder
+	last := 0
+	for _, m := range matches {
+		start, end := m[0], m[1]
+		user := text[m[2]:m[3]]
+		// skip the @ of email addresses and the like
+		if r, _ := utf8.DecodeLastRuneInString(text[:start]); start > 0 && (unicode.IsLetter(r) || unicode.IsDigit(r)) {
+			continue
+		}
+
+		b.WriteString(text[last:start])
+		last = end
+
+		if user == mentionAll {
+			if isAdmin {
+				for _, p := range group.Participants {
+					if !isSelf(p) {
+						mention(p.JID)
+					}
+				}
+			}
+			b.WriteString(text[start:end])
+			continue
+		}
+
+		token := text[start:end]
+		for _, p := range group.Participants {
+			if p.JID.User == user || p.PhoneNumber.User == user || p.LID.User == user {
+				mention(p.JID)
+				token = "@" + p.JID.User
+				break
+			}
+		}
+		b.WriteString(token)
+	}
+	b.WriteString(text[last:])
+
+	return b.String(), mentioned, nil
+}
+
+// withMentions adds mentioned JIDs to the context info of a message,
+// creating it when needed
+func withMentions(contextInfo *waE2E.ContextInfo, mentioned []string) *waE2E.ContextInfo {
+	if len(mentioned) == 0 {
+		return contextInfo
+	}
+	if contextInfo == nil {
+		contextInfo = &waE2E.ContextInfo{}
+	}
+	contextInfo.MentionedJID = mentioned
+	return contextInfo
+}
@@ -5,14 +5,13 @@ import (
 	"fmt"
 	"log"
 
-	"github.com/lugvitc/whats4linux/internal/markdown"
 	"github.com/lugvitc/whats4linux/internal/store"
 	mtypes "github.com/lugvitc/whats4linux/internal/types"
+	"github.com/lugvitc/whats4linux/internal/wa"
 	"github.com/wailsapp/wails/v2/pkg/runtime"
 	"go.mau.fi/whatsmeow"
 	"go.mau.fi/whatsmeow/proto/waE2E"
 	"go.mau.fi/whatsmeow/types"
-	"go.mau.fi/whatsmeow/types/events"
 	"google.golang.org/protobuf/proto"
 )
 
@@ -21,58 +20,21 @@ type MessageContent struct {
 	Text            string `json:"text,omitempty"`
 	Base64Data      string `json:"base64Data,omitempty"`
 	QuotedMessageID string `json:"quotedMessageId,omitempty"`
+	// FileName is the name of the file sent, shown to the recipients of
+	// documents and used to detect their type
+	FileName string `json:"fileName,omitempty"`
+	// Mentions are JIDs mentioned in Text, in addition to the @<number>
+	// tokens resolved by resolveMentions
+	Mentions []string `json:"mentions,omitempty"`
 }
 
-func (a *Api) processMessageText(msg *waE2E.Message) string {
-	if msg == nil {
-		return ""
-	}
-	var text string
-	var mentionedJIDs []string
-
-	if msg.GetConversation() != "" {
-		text = msg.GetConversation()
-	} else if msg.GetExtendedTextMessage() != nil {
-		text = msg.GetExtendedTextMessage().GetText()
-		if msg.GetExtendedTextMessage().GetContextInfo() != nil {
-			mentionedJIDs = msg.GetExtendedTextMessage().GetContextInfo().GetMentionedJID()
-		}
-	} else {
-		switch {
-		case msg.GetImageMessage() != nil:
-			text = msg.GetImageMessage().GetCaption()
-			if msg.GetImageMessage().GetContextInfo() != nil {
-				mentionedJIDs = msg.GetImageMessage().GetContextInfo().GetMentionedJID()
-			}
-		case msg.GetVideoMessage() != nil:
-			text = msg.GetVideoMessage().GetCaption()
-			if msg.GetVideoMessage().GetContextInfo() != nil {
-				mentionedJIDs = msg.GetVideoMessage().GetContextInfo().GetMentionedJID()
-			}
-		case msg.GetDocumentMessage() != nil:
-			text = msg.GetDocumentMessage().GetCaption()
-			if msg.GetDocumentMessage().GetContextInfo() != nil {
-				mentionedJIDs = msg.GetDocumentMessage().GetContextInfo().GetMentionedJID()
-			}
+func (a *Api) FetchMessagesPaged(jid string, limit int, beforeTimestamp int64) ([]store.DecodedMessage, error) {
+	// the first page is loaded when a chat is opened
+	if beforeTimestamp == 0 {
+		if parsedJid, err := types.ParseJID(jid); err == nil {
+			go a.subscribePresence(parsedJid)
 		}
 	}
-
-	if text == "" {
-		return ""
-	}
-
-	// First convert Markdown to HTML (which handles escaping)
-	htmlText := markdown.MarkdownLinesToHTML(text)
-
-	// Then replace mentions in the HTML
-	if len(mentionedJIDs) > 0 {
-		htmlText = replaceMentions(htmlText, mentionedJIDs, a)
-	}
-
-	return htmlText
-}
-
-func (a *Api) FetchMessagesPaged(jid string, limit int, beforeTimestamp int64) ([]store.DecodedMessage, error) {
 	messages, err := a.messageStore.GetDecodedMessagesPaged(jid, beforeTimestamp, limit)
 	if err != nil {
 		return nil, err
@@ -80,6 +42,16 @@ func (a *Api) FetchMessagesPaged(jid string, limit int, beforeTimestamp int64) (
 	return messages, nil
 }
 
+// SearchMessages runs a full-text search over the stored message history
+func (a *Api) SearchMessages(query string, filters store.SearchFilters) ([]store.SearchResult, error) {
+	return a.messageStore.SearchMessages(query, filters)
+}
+
+// GetMessageEditHistory returns the prior versions of an edited message, oldest first
+func (a *Api) GetMessageEditHistory(chatJID, messageID string) ([]store.MessageEdit, error) {
+	return a.messageStore.GetMessageEditHistory(chatJID, messageID)
+}
+
 func buildQuotedMessage(msg *store.ExtendedMessage) *waE2E.Message {
 	if msg == nil {
 		return nil
@@ -189,6 +161,12 @@ func (a *Api) SendMessage(chatJID string, content MessageContent) (string, error
 		return "", err
 	}
 
+	var mentioned []string
+	content.Text, mentioned, err = a.resolveMentions(parsedJID, content.Text, content.Mentions)
+	if err != nil {
+		return "", err
+	}
+
 	var msgContent *waE2E.Message
 
 	switch content.Type {
@@ -198,6 +176,7 @@ func (a *Api) SendMessage(chatJID string, content MessageContent) (string, error
 			log.Println("Failed to build quoted context:", err)
 			return "", err
 		}
+		contextInfo = withMentions(contextInfo, mentioned)
 
 		if contextInfo != nil {
 			msgContent = &waE2E.Message{
@@ -211,208 +190,51 @@ func (a *Api) SendMessage(chatJID string, content MessageContent) (string, error
 				Conversation: &content.Text,
 			}
 		}
-	case "image":
-		// Decode base64 image data
-		imageData, err := base64.StdEncoding.DecodeString(content.Base64Data)
-		if err != nil {
-			return "", fmt.Errorf("failed to decode base64 image data: %v", err)
-		}
-
-		// Create image message
-		mimeType := "image/jpeg"
-		imageMsg := &waE2E.ImageMessage{
-			Mimetype:      &mimeType,
-			Caption:       &content.Text,
-			JPEGThumbnail: nil, // We'll let WhatsApp generate the thumbnail
-		}
-
-		// Upload the image
-		uploaded, err := a.waClient.Upload(a.ctx, imageData, whatsmeow.MediaImage)
-		if err != nil {
-			return "", fmt.Errorf("failed to upload image: %v", err)
-		}
-
-		imageMsg.URL = &uploaded.URL
-		imageMsg.DirectPath = &uploaded.DirectPath
-		imageMsg.MediaKey = uploaded.MediaKey
-		imageMsg.FileEncSHA256 = uploaded.FileEncSHA256
-		imageMsg.FileSHA256 = uploaded.FileSHA256
-		imageMsg.FileLength = &uploaded.FileLength
-
-		msgContent = &waE2E.Message{
-			ImageMessage: imageMsg,
-		}
-	case "video":
-		// Decode base64 video data
-		videoData, err := base64.StdEncoding.DecodeString(content.Base64Data)
-		if err != nil {
-			return "", fmt.Errorf("failed to decode base64 video data: %v", err)
-		}
-
-		// Create video message
-		mimeType := "video/mp4"
-		videoMsg := &waE2E.VideoMessage{
-			Mimetype:      &mimeType,
-			Caption:       &content.Text,
-			JPEGThumbnail: nil, // We'll let WhatsApp generate the thumbnail
-		}
-
-		// Upload the video
-		uploaded, err := a.waClient.Upload(a.ctx, videoData, whatsmeow.MediaVideo)
-		if err != nil {
-			return "", fmt.Errorf("failed to upload video: %v", err)
-		}
-
-		videoMsg.URL = &uploaded.URL
-		videoMsg.DirectPath = &uploaded.DirectPath
-		videoMsg.MediaKey = uploaded.MediaKey
-		videoMsg.FileEncSHA256 = uploaded.FileEncSHA256
-		videoMsg.FileSHA256 = uploaded.FileSHA256
-		videoMsg.FileLength = &uploaded.FileLength
-
-		msgContent = &waE2E.Message{
-			VideoMessage: videoMsg,
-		}
-	case "audio":
-		// Decode base64 audio data
-		audioData, err := base64.StdEncoding.DecodeString(content.Base64Data)
+	case "image", "video", "audio", "document", "sticker":
+		// Decode base64 media data
+		data, err := base64.StdEncoding.DecodeString(content.Base64Data)
 		if err != nil {
-			return "", fmt.Errorf("failed to decode base64 audio data: %v", err)
-		}
-
-		// Create audio message
-		mimeType := "audio/ogg"
-		audioMsg := &waE2E.AudioMessage{
-			Mimetype: &mimeType,
+			return "", fmt.Errorf("failed to decode base64 %s data: %v", content.Type, err)
 		}
-
-		// Upload the audio
-		uploaded, err := a.waClient.Upload(a.ctx, audioData, whatsmeow.MediaAudio)
-		if err != nil {
-			return "", fmt.Errorf("failed to upload audio: %v", err)
-		}
-
-		audioMsg.URL = &uploaded.URL
-		audioMsg.DirectPath = &uploaded.DirectPath
-		audioMsg.MediaKey = uploaded.MediaKey
-		audioMsg.FileEncSHA256 = uploaded.FileEncSHA256
-		audioMsg.FileSHA256 = uploaded.FileSHA256
-		audioMsg.FileLength = &uploaded.FileLength
-
-		msgContent = &waE2E.Message{
-			AudioMessage: audioMsg,
-		}
-	case "document":
-		// Decode base64 document data
-		documentData, err := base64.StdEncoding.DecodeString(content.Base64Data)
-		if err != nil {
-			return "", fmt.Errorf("failed to decode base64 document data: %v", err)
-		}
-
-		// Create document message
-		mimeType := "application/pdf" // Default, should be detected
-		fileName := "document.pdf"    // Default, should be provided
-		documentMsg := &waE2E.DocumentMessage{
-			Mimetype: &mimeType,
-			FileName: &fileName,
-			Caption:  &content.Text,
-		}
-
-		// Upload the document
-		uploaded, err := a.waClient.Upload(a.ctx, documentData, whatsmeow.MediaDocument)
-		if err != nil {
-			return "", fmt.Errorf("failed to upload document: %v", err)
-		}
-
-		documentMsg.URL = &uploaded.URL
-		documentMsg.DirectPath = &uploaded.DirectPath
-		documentMsg.MediaKey = uploaded.MediaKey
-		documentMsg.FileEncSHA256 = uploaded.FileEncSHA256
-		documentMsg.FileSHA256 = uploaded.FileSHA256
-		documentMsg.FileLength = &uploaded.FileLength
-
-		msgContent = &waE2E.Message{
-			DocumentMessage: documentMsg,
-		}
-	case "sticker":
-		// Decode base64 sticker data
-		stickerData, err := base64.StdEncoding.DecodeString(content.Base64Data)
-		if err != nil {
-			return "", fmt.Errorf("failed to decode base64 sticker data: %v", err)
+		// images sent as stickers go through the sticker pipeline first
+		if content.Type == "sticker" && wa.DetectMime(data, content.FileName) != "image/webp" {
+			data, err = a.makeSticker(data, StickerOptions{})
+			if err != nil {
+				return "", fmt.Errorf("failed to make sticker: %w", err)
+			}
 		}
 
-		// Create sticker message
-		mimeType := "image/webp"
-		stickerMsg := &waE2E.StickerMessage{
-			Mimetype: &mimeType,
-		}
+		at := newAttachment(content.Type, content.FileName, data, int64(len(data)))
+		at.caption, at.mentions = content.Text, mentioned
 
-		// Upload the sticker
-		uploaded, err := a.waClient.Upload(a.ctx, stickerData, whatsmeow.MediaImage) // Stickers use MediaImage
+		// Upload the media
+		uploaded, err := a.waClient.Upload(a.ctx, data, uploadMediaTypes[content.Type])
 		if err != nil {
-			return "", fmt.Errorf("failed to upload sticker: %v", err)
+			return "", fmt.Errorf("failed to upload %s: %v", content.Type, err)
 		}
 
-		stickerMsg.URL = &uploaded.URL
-		stickerMsg.DirectPath = &uploaded.DirectPath
-		stickerMsg.MediaKey = uploaded.MediaKey
-		stickerMsg.FileEncSHA256 = uploaded.FileEncSHA256
-		stickerMsg.FileSHA256 = uploaded.FileSHA256
-		stickerMsg.FileLength = &uploaded.FileLength
-
-		msgContent = &waE2E.Message{
-			StickerMessage: stickerMsg,
-		}
+		msgContent = at.message(uploaded)
 	default:
 		return "", fmt.Errorf("unsupported message type: %s", content.Type)
 	}
 
+	return a.sendMessage(parsedJID, msgContent)
+}
+
+// sendMessage sends a message, then stores it and emits it to the frontend
+// so the UI updates immediately
+func (a *Api) sendMessage(parsedJID types.JID, msgContent *waE2E.Message, extra ...whatsmeow.SendRequestExtra) (string, error) {
 	log.Printf("SendMessage Content: %+v\n", msgContent)
 
-	resp, err := a.waClient.SendMessage(a.ctx, parsedJID, msgContent)
+	resp, err := a.waClient.SendMessage(a.ctx, parsedJID, msgContent, extra...)
 	if err != nil {
 		log.Println("SendMessage error:", err)
 		return "", err
 	}
 
 	// Manually add to store and emit event so UI updates immediately
-	msgEvent := &events.Message{
-		Info: types.MessageInfo{
-			ID:        resp.ID,
-			Timestamp: resp.Timestamp,
-			MessageSource: types.MessageSource{
-				Chat:     parsedJID,
-				IsFromMe: true,
-				Sender:   *a.waClient.Store.ID,
-			},
-		},
-		Message: msgContent,
-	}
-	parsedHTML := a.processMessageText(msgContent)
-	messageID := a.messageStore.ProcessMessageEvent(a.ctx, a.waClient.Store.LIDs, msgEvent, parsedHTML)
-
-	// Extract message text for chat list update
-	var messageText string
-	if msgContent.GetConversation() != "" {
-		messageText = msgContent.GetConversation()
-	} else if msgContent.GetExtendedTextMessage() != nil {
-		messageText = msgContent.GetExtendedTextMessage().GetText()
-	} else {
-		switch {
-		case msgContent.GetImageMessage() != nil:
-			messageText = "image"
-		case msgContent.GetVideoMessage() != nil:
-			messageText = "video"
-		case msgContent.GetAudioMessage() != nil:
-			messageText = "audio"
-		case msgContent.GetDocumentMessage() != nil:
-			messageText = "document"
-		case msgContent.GetStickerMessage() != nil:
-			messageText = "sticker"
-		default:
-			messageText = "message"
-		}
-	}
+	msgEvent := a.ownMessageEvent(parsedJID, resp, msgContent)
+	messageID := a.messageStore.ProcessMessageEvent(a.ctx, a.waClient.Store.LIDs, msgEvent)
 
 	var msg any
 	if messageID != "" {
@@ -433,12 +255,9 @@ func (a *Api) SendMessage(chatJID string, content MessageContent) (string, error
 	}
 
 	runtime.EventsEmit(a.ctx, "wa:new_message", map[string]any{
-		"chatId":      parsedJID.String(),
-		"message":     msg,
-		"messageText": messageText,
-		"parsedHTML":  parsedHTML,
-		"timestamp":   resp.Timestamp.Unix(),
-		"sender":      "You",
+		"chatId":  parsedJID.String(),
+		"message": msg,
+		"sender":  "You",
 	})
 
 	return resp.ID, nil
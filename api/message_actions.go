@@ -0,0 +1,129 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/wailsapp/wails/v2/pkg/runtime"
+	"go.mau.fi/whatsmeow"
+	"go.mau.fi/whatsmeow/proto/waE2E"
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+	"google.golang.org/protobuf/proto"
+)
+
+// RevokeWindow is how long after sending a message it can be deleted for everyone
+const RevokeWindow = 48 * time.Hour
+
+var (
+	ErrNotFromMe         = errors.New("only our own messages can be changed")
+	ErrMessageDeleted    = errors.New("message was deleted")
+	ErrEditWindowExpired = errors.New("message is too old to be edited")
+	ErrRevokeExpired     = errors.New("message is too old to be deleted for everyone")
+)
+
+// ownMessageEvent builds the event of a message we sent, so it is stored
+// the same way as the ones coming from our other devices
+func (a *Api) ownMessageEvent(chat types.JID, resp whatsmeow.SendResponse, msg *waE2E.Message) *events.Message {
+	return &events.Message{
+		Info: types.MessageInfo{
+			ID:        resp.ID,
+			Timestamp: resp.Timestamp,
+			MessageSource: types.MessageSource{
+				Chat:     chat,
+				IsFromMe: true,
+				Sender:   *a.waClient.Store.ID,
+				IsGroup:  chat.Server == types.GroupServer,
+			},
+		},
+		Message: msg,
+	}
+}
+
+// EditMessage replaces the text of one of our text messages
+func (a *Api) EditMessage(chatJID, messageID, newText string) error {
+	if a.waClient.Store.ID == nil {
+		return fmt.Errorf("client not logged in")
+	}
+	if strings.TrimSpace(newText) == "" {
+		return fmt.Errorf("message text can't be empty")
+	}
+	parsedJID, err := types.ParseJID(chatJID)
+	if err != nil {
+		return err
+	}
+	msg, err := a.messageStore.GetMessageWithMedia(chatJID, messageID)
+	if err != nil {
+		return fmt.Errorf("message not found")
+	}
+	switch {
+	case !msg.Info.IsFromMe:
+		return ErrNotFromMe
+	case msg.Deleted:
+		return ErrMessageDeleted
+	case msg.Media != nil:
+		return fmt.Errorf("only text messages can be edited")
+	case time.Since(msg.Info.Timestamp) > whatsmeow.EditWindow:
+		return ErrEditWindowExpired
+	}
+
+	edit := a.waClient.BuildEdit(parsedJID, messageID, &waE2E.Message{
+		Conversation: proto.String(newText),
+	})
+	resp, err := a.waClient.SendMessage(a.ctx, parsedJID, edit)
+	if err != nil {
+		return err
+	}
+
+	// incoming edits arrive unwrapped from the FutureProofMessage
+	a.mainEventHandler(a.ownMessageEvent(parsedJID, resp, edit.GetEditedMessage().GetMessage()))
+	return nil
+}
+
+// RevokeMessage deletes one of our messages. When forEveryone is set it is
+// revoked for every participant of the chat, otherwise it is only removed
+// from this device.
+func (a *Api) RevokeMessage(chatJID, messageID string, forEveryone bool) error {
+	parsedJID, err := types.ParseJID(chatJID)
+	if err != nil {
+		return err
+	}
+	msg, err := a.messageStore.GetMessageWithMedia(chatJID, messageID)
+	if err != nil {
+		return fmt.Errorf("message not found")
+	}
+
+	if !forEveryone {
+		err = a.messageStore.DeleteMessage(parsedJID, messageID)
+		if err != nil {
+			return err
+		}
+		runtime.EventsEmit(a.ctx, "wa:message_deleted", map[string]any{
+			"chatId":    chatJID,
+			"messageId": messageID,
+		})
+		return nil
+	}
+
+	if a.waClient.Store.ID == nil {
+		return fmt.Errorf("client not logged in")
+	}
+	switch {
+	case !msg.Info.IsFromMe:
+		return ErrNotFromMe
+	case msg.Deleted:
+		return ErrMessageDeleted
+	case time.Since(msg.Info.Timestamp) > RevokeWindow:
+		return ErrRevokeExpired
+	}
+
+	revoke := a.waClient.BuildRevoke(parsedJID, types.EmptyJID, messageID)
+	resp, err := a.waClient.SendMessage(a.ctx, parsedJID, revoke)
+	if err != nil {
+		return err
+	}
+	a.mainEventHandler(a.ownMessageEvent(parsedJID, resp, revoke))
+	return nil
+}
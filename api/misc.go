@@ -1,9 +1,6 @@
 package api
 
 import (
-	"html"
-	"strings"
-
 	"github.com/lugvitc/whats4linux/internal/misc"
 	"github.com/lugvitc/whats4linux/internal/settings"
 	"github.com/lugvitc/whats4linux/internal/store"
@@ -42,30 +39,20 @@ func (a *Api) GetSettings() map[string]any {
 	return store.GetSettings()
 }
 
-func replaceMentions(text string, mentionedJIDs []string, a *Api) string {
-	result := text
-
-	for _, jid := range mentionedJIDs {
-		parsedJID, err := types.ParseJID(jid)
-		if err != nil {
-			continue
-		}
-		parsedJID = canonicalUserJID(a.ctx, a.waClient, parsedJID)
-		contact, _ := a.waClient.Store.Contacts.GetContact(a.ctx, parsedJID)
-		displayName := contact.FullName
-		if displayName == "" {
-			displayName = "~ " + contact.PushName
-		}
-		if displayName == "" {
-			displayName = parsedJID.User
-		}
-
-		mentionPattern := "@" + strings.Split(jid, "@")[0]
-		mentionHTML := `<span class="mention">@` + html.EscapeString(displayName) + `</span>`
-		result = strings.ReplaceAll(result, mentionPattern, mentionHTML)
+// mentionName returns the name shown for a mentioned user in rendered messages
+func (a *Api) mentionName(jid types.JID) string {
+	jid = canonicalUserJID(a.ctx, a.waClient, jid)
+	contact, err := a.waClient.Store.Contacts.GetContact(a.ctx, jid)
+	if err != nil {
+		return ""
 	}
-
-	return result
+	if contact.FullName != "" {
+		return contact.FullName
+	}
+	if contact.PushName != "" {
+		return "~ " + contact.PushName
+	}
+	return ""
 }
 
 func (a *Api) GetProfileColor(jidStr string) string {
@@ -0,0 +1,77 @@
+package api
+
+import (
+	"log"
+
+	"github.com/wailsapp/wails/v2/pkg/runtime"
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+)
+
+// Presence is the last known online state of a contact. LastSeen is a unix
+// timestamp, 0 when the contact hides it.
+type Presence struct {
+	Online   bool  `json:"online"`
+	LastSeen int64 `json:"last_seen"`
+}
+
+// subscribePresence asks the server for presence updates of a contact. The
+// server forgets subscriptions on reconnect, see resetPresence.
+func (a *Api) subscribePresence(jid types.JID) {
+	if jid.Server != types.DefaultUserServer && jid.Server != types.HiddenUserServer {
+		return
+	}
+	key := jid.ToNonAD().String()
+	if !a.presenceSubs.SetIfAbsent(key, true) {
+		return
+	}
+	err := a.waClient.SubscribePresence(a.ctx, jid)
+	if err != nil {
+		log.Println("Failed to subscribe to presence:", err)
+		a.presenceSubs.Delete(key)
+	}
+}
+
+func (a *Api) resetPresence() {
+	a.presenceSubs.Clear()
+	a.presences.Clear()
+}
+
+// GetPresence returns the last known presence of a contact, the contact's
+// chat must have been opened for the server to send updates
+func (a *Api) GetPresence(jid string) (Presence, error) {
+	parsedJid, err := types.ParseJID(jid)
+	if err != nil {
+		return Presence{}, err
+	}
+	presence, _ := a.presences.Get(canonicalUserJID(a.ctx, a.waClient, parsedJid).String())
+	return presence, nil
+}
+
+func (a *Api) handlePresence(v *events.Presence) {
+	jid := canonicalUserJID(a.ctx, a.waClient, v.From).String()
+	presence := Presence{Online: !v.Unavailable}
+	if !v.LastSeen.IsZero() {
+		presence.LastSeen = v.LastSeen.Unix()
+	}
+	a.presences.Set(jid, presence)
+
+	runtime.EventsEmit(a.ctx, "wa:presence", map[string]any{
+		"jid":      jid,
+		"online":   presence.Online,
+		"lastSeen": presence.LastSeen,
+	})
+}
+
+func (a *Api) handleChatPresence(v *events.ChatPresence) {
+	chat := v.Chat
+	if chat.Server != types.GroupServer {
+		chat = canonicalUserJID(a.ctx, a.waClient, chat)
+	}
+	runtime.EventsEmit(a.ctx, "wa:typing", map[string]any{
+		"chatId": chat.String(),
+		"sender": canonicalUserJID(a.ctx, a.waClient, v.Sender).String(),
+		"state":  v.State,
+		"media":  v.Media,
+	})
+}
@@ -0,0 +1,58 @@
+package api
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/wailsapp/wails/v2/pkg/runtime"
+	"go.mau.fi/whatsmeow/types"
+)
+
+// SendReaction reacts to a message, an empty emoji removes our reaction
+func (a *Api) SendReaction(chatJID, messageID, emoji string) error {
+	if a.waClient.Store.ID == nil {
+		return fmt.Errorf("client not logged in")
+	}
+	parsedJID, err := types.ParseJID(chatJID)
+	if err != nil {
+		return err
+	}
+	msg, err := a.messageStore.GetMessageWithMedia(chatJID, messageID)
+	if err != nil {
+		return fmt.Errorf("message not found")
+	}
+
+	// the key of our own messages has no participant
+	sender := msg.Info.Sender
+	if msg.Info.IsFromMe {
+		sender = types.EmptyJID
+	}
+	_, err = a.waClient.SendMessage(a.ctx, parsedJID, a.waClient.BuildReaction(parsedJID, sender, messageID, emoji))
+	if err != nil {
+		return err
+	}
+
+	selfJID := canonicalUserJID(a.ctx, a.waClient, *a.waClient.Store.ID).String()
+	err = a.messageStore.AddReactionToMessage(messageID, emoji, selfJID)
+	if err != nil {
+		return err
+	}
+	a.emitReaction(chatJID, messageID, selfJID, emoji)
+	return nil
+}
+
+// emitReaction tells the frontend the reactions of a message changed, an
+// empty emoji means the sender removed their reaction
+func (a *Api) emitReaction(chatJID, messageID, senderJID, emoji string) {
+	reactions, err := a.messageStore.GetReactionsByMessageID(messageID)
+	if err != nil {
+		log.Println("Failed to get reactions:", err)
+	}
+	runtime.EventsEmit(a.ctx, "wa:reaction", map[string]any{
+		"chatId":    chatJID,
+		"messageId": messageID,
+		"sender":    senderJID,
+		"emoji":     emoji,
+		"reactions": reactions,
+	})
+}
@@ -0,0 +1,93 @@
+package api
+
+import (
+	"log"
+
+	"github.com/lugvitc/whats4linux/internal/store"
+	"github.com/wailsapp/wails/v2/pkg/runtime"
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+)
+
+// receiptStatus maps the receipts sent by our contacts to a message status,
+// other receipt types don't change the delivery state
+func receiptStatus(t types.ReceiptType) (store.MessageStatus, bool) {
+	switch t {
+	case types.ReceiptTypeDelivered:
+		return store.MessageStatusDelivered, true
+	case types.ReceiptTypeRead:
+		return store.MessageStatusRead, true
+	case types.ReceiptTypePlayed:
+		return store.MessageStatusPlayed, true
+	}
+	return store.MessageStatusPending, false
+}
+
+// receiptRecipients returns how many recipients a message sent to chat has
+func (a *Api) receiptRecipients(chat types.JID) int {
+	if chat.Server != types.GroupServer {
+		return 1
+	}
+	group, err := a.cw.FetchGroup(chat.String())
+	if err != nil {
+		return 1
+	}
+	// every participant except us
+	return max(group.ParticipantCount-1, 1)
+}
+
+func (a *Api) handleReceipt(v *events.Receipt) {
+	if v.IsFromMe {
+		// messages read on another device of ours
+		if v.Type == types.ReceiptTypeReadSelf {
+			a.handleReadSelf(v)
+		}
+		return
+	}
+	status, ok := receiptStatus(v.Type)
+	if !ok {
+		return
+	}
+
+	statuses, err := a.messageStore.AddReceipts(
+		a.ctx, a.waClient.Store.LIDs,
+		v.Sender, v.MessageIDs,
+		status, v.Timestamp, a.receiptRecipients(v.Chat),
+	)
+	if err != nil {
+		log.Println("Failed to store receipt:", err)
+		return
+	}
+	if len(statuses) == 0 {
+		return
+	}
+
+	names := make(map[string]string, len(statuses))
+	for id, s := range statuses {
+		names[id] = s.String()
+	}
+	runtime.EventsEmit(a.ctx, "wa:receipt", map[string]any{
+		"chatId":     v.Chat.String(),
+		"messageIds": v.MessageIDs,
+		"recipient":  v.Sender.ToNonAD().String(),
+		"type":       status.String(),
+		"timestamp":  v.Timestamp.Unix(),
+		"statuses":   names,
+	})
+}
+
+func (a *Api) handleReadSelf(v *events.Receipt) {
+	chat := store.CanonicalJID(a.ctx, a.waClient.Store.LIDs, v.Chat).String()
+	err := a.messageStore.MarkMessagesRead(chat, v.MessageIDs)
+	if err != nil {
+		log.Println("Failed to sync read receipt:", err)
+		return
+	}
+	a.emitUnreadCount(chat)
+}
+
+// GetMessageReceipts returns who a message of ours was delivered to, read
+// and played by
+func (a *Api) GetMessageReceipts(chatJID, messageID string) ([]store.MessageReceipt, error) {
+	return a.messageStore.GetMessageReceipts(chatJID, messageID)
+}
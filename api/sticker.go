@@ -0,0 +1,86 @@
+package api
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/lugvitc/whats4linux/internal/misc"
+	"github.com/lugvitc/whats4linux/internal/wa"
+	"github.com/wailsapp/wails/v2/pkg/runtime"
+	"go.mau.fi/whatsmeow/types"
+)
+
+// StickerOptions are the metadata of the stickers made from images. The pack
+// defaults to the app and the author to our push name.
+type StickerOptions struct {
+	PackName string   `json:"packName,omitempty"`
+	Author   string   `json:"author,omitempty"`
+	Emojis   []string `json:"emojis,omitempty"`
+}
+
+// makeSticker turns an image into a sticker, see wa.MakeSticker
+func (a *Api) makeSticker(data []byte, opts StickerOptions) ([]byte, error) {
+	meta := wa.StickerMetadata{
+		PackName:  opts.PackName,
+		Publisher: opts.Author,
+		Emojis:    opts.Emojis,
+	}
+	if meta.PackName == "" {
+		meta.PackName = misc.APP_NAME
+	}
+	if meta.Publisher == "" {
+		meta.Publisher = a.waClient.Store.PushName
+	}
+	return wa.MakeSticker(data, meta)
+}
+
+// SendImageAsSticker turns a PNG, JPEG or GIF image into a sticker and sends
+// it. An empty path asks for the image with a dialog. It returns the ID of
+// the message, empty when the dialog is dismissed.
+func (a *Api) SendImageAsSticker(chatJID, path string, opts StickerOptions) (string, error) {
+	if a.waClient.Store.ID == nil {
+		return "", fmt.Errorf("client not logged in")
+	}
+
+	parsedJID, err := types.ParseJID(chatJID)
+	if err != nil {
+		return "", err
+	}
+
+	if path == "" {
+		path, err = runtime.OpenFileDialog(a.ctx, runtime.OpenDialogOptions{
+			Title: "Send image as sticker",
+			Filters: []runtime.FileFilter{{
+				DisplayName: "Images",
+				Pattern:     "*.png;*.jpg;*.jpeg;*.gif",
+			}},
+		})
+		if err != nil || path == "" {
+			return "", err
+		}
+	}
+
+	stat, err := os.Stat(path)
+	if err != nil {
+		return "", err
+	}
+	if limit := maxUploadSize["image"]; stat.Size() > limit {
+		return "", fmt.Errorf("image is too large to make a sticker, the limit is %d MB", limit>>20)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	sticker, err := a.makeSticker(data, opts)
+	if err != nil {
+		return "", fmt.Errorf("failed to make sticker: %w", err)
+	}
+
+	at := newAttachment("sticker", "", sticker, int64(len(sticker)))
+	uploaded, err := a.waClient.Upload(a.ctx, sticker, uploadMediaTypes["sticker"])
+	if err != nil {
+		return "", fmt.Errorf("failed to upload sticker: %v", err)
+	}
+
+	return a.sendMessage(parsedJID, at.message(uploaded))
+}
@@ -0,0 +1,449 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lugvitc/whats4linux/internal/wa"
+	"github.com/wailsapp/wails/v2/pkg/runtime"
+	"go.mau.fi/whatsmeow"
+	"go.mau.fi/whatsmeow/proto/waE2E"
+	"go.mau.fi/whatsmeow/types"
+	"google.golang.org/protobuf/proto"
+)
+
+// uploadMediaTypes maps the kinds of attachments to the media type they are
+// uploaded as
+var uploadMediaTypes = map[string]whatsmeow.MediaType{
+	"image":    whatsmeow.MediaImage,
+	"video":    whatsmeow.MediaVideo,
+	"audio":    whatsmeow.MediaAudio,
+	"document": whatsmeow.MediaDocument,
+	// whatsmeow has no media type of its own for stickers, they are
+	// encrypted with the keys of images
+	"sticker": whatsmeow.MediaImage,
+}
+
+// maxUploadSize holds WhatsApp's size limits for each kind of attachment
+var maxUploadSize = map[string]int64{
+	"image":    16 << 20,
+	"video":    16 << 20,
+	"audio":    16 << 20,
+	"document": 2 << 30,
+	"sticker":  500 << 10,
+}
+
+// maxInspectSize is the largest file read whole into memory to describe it,
+// larger documents are sent without a page count
+const maxInspectSize = 64 << 20
+
+// sniffSize is how much of larger files is read to detect their type
+const sniffSize = 512
+
+// progressInterval is the minimum time between two wa:upload_progress events
+// of an upload
+const progressInterval = 200 * time.Millisecond
+
+// attachment is media about to be sent
+type attachment struct {
+	kind     string
+	mime     string
+	fileName string
+	caption  string
+	mentions []string
+
+	thumbnail     []byte
+	width, height int
+	pages         int
+
+	// ptt marks voice notes, which phones show with their waveform
+	ptt      bool
+	seconds  uint32
+	waveform []byte
+}
+
+// newAttachment describes media of the given kind. data holds the content of
+// the file, or only its start when the file is larger than maxInspectSize.
+func newAttachment(kind, fileName string, data []byte, size int64) *attachment {
+	at := &attachment{
+		kind: kind,
+		mime: wa.DetectMime(data, fileName),
+	}
+
+	complete := int64(len(data)) == size
+	switch kind {
+	case "image":
+		if !complete {
+			break
+		}
+		thumbnail, width, height, err := wa.ImageThumbnail(data)
+		if err != nil {
+			log.Println("Failed to generate image thumbnail:", err)
+			break
+		}
+		at.thumbnail, at.width, at.height = thumbnail, width, height
+	case "audio":
+		// m4a files are sniffed as mp4 video
+		if strings.HasPrefix(at.mime, "video/") {
+			at.mime = "audio/" + strings.TrimPrefix(at.mime, "video/")
+		}
+		// ogg/opus is what phones record, send it as a voice note
+		if complete && at.mime == "audio/ogg; codecs=opus" {
+			seconds, waveform, err := wa.OpusVoiceInfo(data)
+			if err != nil {
+				log.Println("Failed to read voice note:", err)
+				break
+			}
+			at.ptt, at.seconds, at.waveform = true, seconds, waveform
+		}
+	case "sticker":
+		if width, height, ok := wa.WebPSize(data); ok {
+			at.width, at.height = width, height
+		}
+	case "document":
+		at.fileName = wa.FileNameFor(fileName, at.mime)
+		if complete {
+			at.pages = wa.PDFPageCount(data)
+		}
+	}
+	return at
+}
+
+// message builds the message of an uploaded attachment
+func (at *attachment) message(uploaded whatsmeow.UploadResponse) *waE2E.Message {
+	contextInfo := withMentions(nil, at.mentions)
+
+	switch at.kind {
+	case "image":
+		imageMsg := &waE2E.ImageMessage{
+			Mimetype:    &at.mime,
+			Caption:     &at.caption,
+			ContextInfo: contextInfo,
+		}
+		if at.thumbnail != nil {
+			imageMsg.JPEGThumbnail = at.thumbnail
+			imageMsg.Width = proto.Uint32(uint32(at.width))
+			imageMsg.Height = proto.Uint32(uint32(at.height))
+		}
+
+		imageMsg.URL = &uploaded.URL
+		imageMsg.DirectPath = &uploaded.DirectPath
+		imageMsg.MediaKey = uploaded.MediaKey
+		imageMsg.FileEncSHA256 = uploaded.FileEncSHA256
+		imageMsg.FileSHA256 = uploaded.FileSHA256
+		imageMsg.FileLength = &uploaded.FileLength
+
+		return &waE2E.Message{ImageMessage: imageMsg}
+	case "video":
+		videoMsg := &waE2E.VideoMessage{
+			Mimetype:    &at.mime,
+			Caption:     &at.caption,
+			ContextInfo: contextInfo,
+		}
+
+		videoMsg.URL = &uploaded.URL
+		videoMsg.DirectPath = &uploaded.DirectPath
+		videoMsg.MediaKey = uploaded.MediaKey
+		videoMsg.FileEncSHA256 = uploaded.FileEncSHA256
+		videoMsg.FileSHA256 = uploaded.FileSHA256
+		videoMsg.FileLength = &uploaded.FileLength
+
+		return &waE2E.Message{VideoMessage: videoMsg}
+	case "audio":
+		audioMsg := &waE2E.AudioMessage{
+			Mimetype: &at.mime,
+		}
+		if at.ptt {
+			audioMsg.PTT = proto.Bool(true)
+			audioMsg.Seconds = proto.Uint32(at.seconds)
+			audioMsg.Waveform = at.waveform
+		}
+
+		audioMsg.URL = &uploaded.URL
+		audioMsg.DirectPath = &uploaded.DirectPath
+		audioMsg.MediaKey = uploaded.MediaKey
+		audioMsg.FileEncSHA256 = uploaded.FileEncSHA256
+		audioMsg.FileSHA256 = uploaded.FileSHA256
+		audioMsg.FileLength = &uploaded.FileLength
+
+		return &waE2E.Message{AudioMessage: audioMsg}
+	case "document":
+		documentMsg := &waE2E.DocumentMessage{
+			Mimetype:    &at.mime,
+			FileName:    &at.fileName,
+			Title:       &at.fileName,
+			Caption:     &at.caption,
+			ContextInfo: contextInfo,
+		}
+		if at.pages > 0 {
+			documentMsg.PageCount = proto.Uint32(uint32(at.pages))
+		}
+
+		documentMsg.URL = &uploaded.URL
+		documentMsg.DirectPath = &uploaded.DirectPath
+		documentMsg.MediaKey = uploaded.MediaKey
+		documentMsg.FileEncSHA256 = uploaded.FileEncSHA256
+		documentMsg.FileSHA256 = uploaded.FileSHA256
+		documentMsg.FileLength = &uploaded.FileLength
+
+		return &waE2E.Message{DocumentMessage: documentMsg}
+	case "sticker":
+		stickerMsg := &waE2E.StickerMessage{
+			Mimetype: &at.mime,
+		}
+		if at.width > 0 {
+			stickerMsg.Width = proto.Uint32(uint32(at.width))
+			stickerMsg.Height = proto.Uint32(uint32(at.height))
+		}
+
+		stickerMsg.URL = &uploaded.URL
+		stickerMsg.DirectPath = &uploaded.DirectPath
+		stickerMsg.MediaKey = uploaded.MediaKey
+		stickerMsg.FileEncSHA256 = uploaded.FileEncSHA256
+		stickerMsg.FileSHA256 = uploaded.FileSHA256
+		stickerMsg.FileLength = &uploaded.FileLength
+
+		return &waE2E.Message{StickerMessage: stickerMsg}
+	}
+	return nil
+}
+
+// kindForMime returns the kind of attachment a file is sent as by default
+func kindForMime(mime string) string {
+	switch {
+	case strings.HasPrefix(mime, "image/"):
+		return "image"
+	case strings.HasPrefix(mime, "video/"):
+		return "video"
+	case strings.HasPrefix(mime, "audio/"):
+		return "audio"
+	}
+	return "document"
+}
+
+// SendFile sends a file from disk as an attachment. kind is one of image,
+// video, audio, document and sticker, or empty to pick it from the type of
+// the file. An empty path asks for the file with a dialog.
+//
+// The upload runs in the background. SendFile returns its ID, which is also
+// the ID of the message, and the upload reports its progress with
+// wa:upload_progress events until it's done, failed or cancelled. An empty
+// ID is returned when the dialog is dismissed.
+func (a *Api) SendFile(chatJID, path, caption, kind string) (string, error) {
+	if a.waClient.Store.ID == nil {
+		return "", fmt.Errorf("client not logged in")
+	}
+
+	parsedJID, err := types.ParseJID(chatJID)
+	if err != nil {
+		return "", err
+	}
+
+	if path == "" {
+		path, err = runtime.OpenFileDialog(a.ctx, runtime.OpenDialogOptions{
+			Title: "Send file",
+		})
+		if err != nil || path == "" {
+			return "", err
+		}
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	stat, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return "", err
+	}
+
+	// read small files whole to describe them, the start of others to detect
+	// their type
+	inspect := stat.Size()
+	if inspect > maxInspectSize {
+		inspect = sniffSize
+	}
+	data := make([]byte, inspect)
+	if _, err := io.ReadFull(f, data); err != nil {
+		f.Close()
+		return "", fmt.Errorf("failed to read file: %w", err)
+	}
+
+	if kind == "" {
+		kind = kindForMime(wa.DetectMime(data, path))
+	}
+	mediaType, ok := uploadMediaTypes[kind]
+	if !ok {
+		f.Close()
+		return "", fmt.Errorf("unsupported attachment type: %s", kind)
+	}
+
+	// images sent as stickers go through the sticker pipeline first, the
+	// sticker is uploaded instead of the file
+	var src io.ReadSeeker = f
+	size := stat.Size()
+	if kind == "sticker" && wa.DetectMime(data, path) != "image/webp" {
+		if limit := maxUploadSize["image"]; size > limit {
+			f.Close()
+			return "", fmt.Errorf("image is too large to make a sticker, the limit is %d MB", limit>>20)
+		}
+		data, err = a.makeSticker(data, StickerOptions{})
+		if err != nil {
+			f.Close()
+			return "", fmt.Errorf("failed to make sticker: %w", err)
+		}
+		src, size = bytes.NewReader(data), int64(len(data))
+	}
+	if limit := maxUploadSize[kind]; size > limit {
+		f.Close()
+		return "", fmt.Errorf("file is too large to send as %s, the limit is %d MB", kind, limit>>20)
+	}
+
+	at := newAttachment(kind, filepath.Base(path), data, size)
+	at.caption, at.mentions, err = a.resolveMentions(parsedJID, caption, nil)
+	if err != nil {
+		f.Close()
+		return "", err
+	}
+
+	uploadID := string(a.waClient.GenerateMessageID())
+	ctx, cancel := context.WithCancel(a.ctx)
+	a.uploads.Set(uploadID, cancel)
+
+	go func() {
+		defer f.Close()
+		defer cancel()
+		defer a.uploads.Delete(uploadID)
+
+		progress := func(state string, sent, total int64, err error) {
+			data := map[string]any{
+				"uploadId": uploadID,
+				"chatId":   parsedJID.String(),
+				"fileName": filepath.Base(path),
+				"state":    state,
+				"sent":     sent,
+				"total":    total,
+			}
+			if err != nil {
+				data["error"] = err.Error()
+			}
+			runtime.EventsEmit(a.ctx, "wa:upload_progress", data)
+		}
+
+		err := a.uploadFile(ctx, uploadID, parsedJID, src, size, mediaType, at, progress)
+		switch {
+		case errors.Is(err, context.Canceled):
+			progress("cancelled", 0, size, nil)
+		case err != nil:
+			log.Println("SendFile error:", err)
+			progress("failed", 0, size, err)
+		default:
+			progress("done", size, size, nil)
+		}
+	}()
+
+	return uploadID, nil
+}
+
+// uploadFile uploads a file and sends it as the message uploadID
+func (a *Api) uploadFile(
+	ctx context.Context,
+	uploadID string,
+	chat types.JID,
+	f io.ReadSeeker,
+	size int64,
+	mediaType whatsmeow.MediaType,
+	at *attachment,
+	progress func(state string, sent, total int64, err error),
+) error {
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	temp, err := os.CreateTemp("", "whats4linux-upload-*")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary file: %w", err)
+	}
+	defer os.Remove(temp.Name())
+	defer temp.Close()
+
+	pf := &progressFile{file: temp, report: func(sent, total int64) {
+		progress("uploading", sent*size/max(total, 1), size, nil)
+	}}
+	uploaded, err := a.waClient.UploadReader(ctx, f, pf, mediaType)
+	if err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		return fmt.Errorf("failed to upload %s: %w", at.kind, err)
+	}
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	_, err = a.sendMessage(chat, at.message(uploaded), whatsmeow.SendRequestExtra{ID: types.MessageID(uploadID)})
+	return err
+}
+
+// CancelUpload cancels an upload started by SendFile, the message is not
+// sent
+func (a *Api) CancelUpload(uploadID string) error {
+	cancel, ok := a.uploads.Get(uploadID)
+	if !ok {
+		return fmt.Errorf("upload not found")
+	}
+	cancel()
+	return nil
+}
+
+// progressFile is the temporary file of an upload. whatsmeow encrypts the
+// file into it, then uploads it from there, so its reads are the progress
+// of the upload and its writes the total. The file isn't embedded, io.Copy
+// would go around the counting through its ReadFrom and WriteTo.
+type progressFile struct {
+	file *os.File
+
+	mu            sync.Mutex
+	written, read int64
+	lastReport    time.Time
+	report        func(sent, total int64)
+}
+
+func (pf *progressFile) Write(p []byte) (int, error) {
+	n, err := pf.file.Write(p)
+	pf.mu.Lock()
+	pf.written += int64(n)
+	pf.mu.Unlock()
+	return n, err
+}
+
+func (pf *progressFile) Read(p []byte) (int, error) {
+	n, err := pf.file.Read(p)
+	pf.mu.Lock()
+	pf.read += int64(n)
+	report := time.Since(pf.lastReport) >= progressInterval || pf.read == pf.written
+	if report {
+		pf.lastReport = time.Now()
+	}
+	read, written := pf.read, pf.written
+	pf.mu.Unlock()
+
+	if report && n > 0 {
+		pf.report(read, written)
+	}
+	return n, err
+}
+
+func (pf *progressFile) Seek(offset int64, whence int) (int64, error) {
+	return pf.file.Seek(offset, whence)
+}
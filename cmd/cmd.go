@@ -46,6 +46,7 @@ func GetApp(assets fs.FS, bArgs BuildArgs) *cli.App {
 			CustomHelpTemplate: CMD_HELP_TEMPL,
 			Action:             common.GetVersion,
 		},
+		exportCmd,
 	}
 
 	return &cli.App{
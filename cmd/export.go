@@ -0,0 +1,103 @@
+package cmd
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/lugvitc/whats4linux/cmd/common"
+	"github.com/lugvitc/whats4linux/internal/cache"
+	"github.com/lugvitc/whats4linux/internal/export"
+	"github.com/lugvitc/whats4linux/internal/misc"
+	"github.com/lugvitc/whats4linux/internal/settings"
+	"github.com/lugvitc/whats4linux/internal/store"
+	"github.com/urfave/cli"
+	"go.mau.fi/whatsmeow/store/sqlstore"
+	"go.mau.fi/whatsmeow/types"
+	waLog "go.mau.fi/whatsmeow/util/log"
+)
+
+var exportCmd = cli.Command{
+	Name:               "export",
+	Usage:              "exports a chat as a text zip archive, json or html",
+	UsageText:          "export [--format text|json|html] [--output <file>] [--no-media] <chat jid>",
+	CustomHelpTemplate: CMD_HELP_TEMPL,
+	OnUsageError:       common.UsageErrorCallback,
+	Flags: []cli.Flag{
+		cli.StringFlag{
+			Name:  "format, f",
+			Value: string(export.FormatText),
+			Usage: "export format: text (zip archive), json or html",
+		},
+		cli.StringFlag{
+			Name:  "output, o",
+			Usage: "path of the export, defaults to \"WhatsApp Chat - <chat>\" with the format's extension",
+		},
+		cli.BoolFlag{
+			Name:  "no-media",
+			Usage: "don't add the downloaded media to the export",
+		},
+		cli.Int64Flag{
+			Name:  "after",
+			Usage: "only export messages sent after this unix timestamp",
+		},
+		cli.Int64Flag{
+			Name:  "before",
+			Usage: "only export messages sent before this unix timestamp",
+		},
+	},
+	Action: exportChat,
+}
+
+func exportChat(ctx *cli.Context) error {
+	chatJID := ctx.Args().First()
+	if chatJID == "" {
+		return common.PrintErrWithCmdHelp(ctx, errors.New("missing chat jid"))
+	}
+	chat, err := types.ParseJID(chatJID)
+	if err != nil {
+		return fmt.Errorf("invalid chat jid: %w", err)
+	}
+
+	opts := export.Options{
+		Format:       export.Format(ctx.String("format")),
+		Path:         ctx.String("output"),
+		IncludeMedia: !ctx.Bool("no-media"),
+		After:        ctx.Int64("after"),
+		Before:       ctx.Int64("before"),
+	}
+	if opts.Path == "" {
+		opts.Path = "WhatsApp Chat - " + chat.User + opts.Format.Ext()
+	}
+
+	bgCtx := context.Background()
+	db, err := sql.Open("sqlite3", misc.GetSQLiteAddress("session.wa"))
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	container := sqlstore.NewWithDB(db, "sqlite3", waLog.Noop)
+	device, err := container.GetFirstDevice(bgCtx)
+	if err != nil {
+		return fmt.Errorf("failed to open session: %w", err)
+	}
+
+	messageStore, err := store.NewMessageStore()
+	if err != nil {
+		return err
+	}
+	mediaCache, err := cache.NewMediaCache(settings.GetMediaCacheQuota())
+	if err != nil {
+		return err
+	}
+	defer mediaCache.Close()
+
+	exporter := export.New(messageStore, mediaCache, device.Contacts, device.PushName)
+	err = exporter.Export(bgCtx, chat.String(), opts)
+	if err != nil {
+		return err
+	}
+	fmt.Println("Exported chat to", opts.Path)
+	return nil
+}
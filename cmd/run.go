@@ -29,7 +29,7 @@ func run(assets fs.FS) cli.ActionFunc {
 			Height: 768,
 			AssetServer: &assetserver.Options{
 				Assets:  assets,
-				Handler: server.NewAssetFileServer(),
+				Handler: server.NewAssetFileServer(apiPkg.NewMediaSource(api)),
 			},
 			BackgroundColour: &options.RGBA{R: 27, G: 38, B: 54, A: 1},
 			OnStartup:        api.Startup,
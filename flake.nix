@@ -47,7 +47,7 @@
             ];
 
             checkPhase = ''
-              go test -v ./...
+              go test -v -tags sqlite_fts5 ./...
             '';
 
             installPhase = ''
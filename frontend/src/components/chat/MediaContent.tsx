@@ -68,10 +68,8 @@ export function MediaContent({
     if (loading) return
     setLoading(true)
     try {
-      const data = await DownloadMedia(chatId, message.Info.ID)
-      setMediaSrc(
-        `data:${(message.Content as any)?.[`${type}Message`]?.mimetype || "application/octet-stream"};base64,${data}`,
-      )
+      const mediaURL = await DownloadMedia(chatId, message.Info.ID)
+      setMediaSrc(mediaURL)
     } catch (e) {
     } finally {
       setLoading(false)
@@ -284,6 +284,7 @@ export function ChatDetail({ chatId, chatName, chatAvatar, onBack }: ChatDetailP
           await SendMessage(chatId, {
             type: fileTypeToSend,
             base64Data: base64,
+            fileName: fileToSend.name,
             text: textToSend,
             quotedMessageId,
           })
@@ -1,7 +1,7 @@
 import { useEffect, useRef, useCallback, memo } from "react"
 import clsx from "clsx"
 import { GetChatList, GetCachedAvatar, GetSelfAvatar } from "../../wailsjs/go/api/Api"
-import { api } from "../../wailsjs/go/models"
+import { api, store } from "../../wailsjs/go/models"
 import { EventsOn } from "../../wailsjs/runtime/runtime"
 import { ChatDetail } from "./ChatDetail"
 import { useChatStore, useChatById, useFilteredChatIds } from "../store"
@@ -73,6 +73,23 @@ interface ChatAvatarProps {
   chat: ChatItem
 }
 
+// lastMessagePreview is the chat list subtitle of a message, its rendered
+// HTML text or caption, or its type when it has none
+const lastMessagePreview = (content?: store.DecodedMessageContent) => {
+  const html =
+    content?.conversation ||
+    content?.extendedTextMessage?.text ||
+    content?.imageMessage?.caption ||
+    content?.videoMessage?.caption
+  if (html) return html
+  if (content?.imageMessage) return "image"
+  if (content?.videoMessage) return "video"
+  if (content?.audioMessage) return "audio"
+  if (content?.documentMessage) return "document"
+  if (content?.stickerMessage) return "sticker"
+  return "message"
+}
+
 const ChatAvatar = ({ chat }: ChatAvatarProps) => {
   if (chat.avatar) {
     return <img src={chat.avatar} alt={chat.name} className="w-full h-full object-cover" />
@@ -396,7 +413,7 @@ export function ChatListScreen({ onOpenSettings }: ChatListScreenProps) {
     // Listen for new messages - update only the specific chat
     const unsubNewMessage = EventsOn(
       "wa:new_message",
-      (data: { chatId: string; messageText: string; timestamp: number; sender: string }) => {
+      (data: { chatId: string; message: store.DecodedMessage; sender: string }) => {
         if (!initialFetchDoneRef.current) {
           // If we haven't done initial fetch, do a full fetch
           setTimeout(fetchChats, 500)
@@ -407,7 +424,13 @@ export function ChatListScreen({ onOpenSettings }: ChatListScreenProps) {
         const existingChat = getChat(data.chatId)
         if (existingChat) {
           // Update only this specific chat - no full re-fetch needed!
-          updateChatLastMessage(data.chatId, data.messageText, data.timestamp, data.sender)
+          const { Info, Content } = data.message
+          updateChatLastMessage(
+            data.chatId,
+            lastMessagePreview(Content),
+            Math.floor(Date.parse(Info.Timestamp) / 1000),
+            data.sender,
+          )
         } else {
           // New chat we don't have - need to fetch to get avatar/name
           setTimeout(fetchChats, 500)
@@ -0,0 +1,47 @@
+package cache
+
+import (
+	"fmt"
+	"time"
+
+	query "github.com/lugvitc/whats4linux/internal/query"
+)
+
+// QueueDownload adds the media of a message to the download queue, unless
+// it is queued already
+func (mc *MediaCache) QueueDownload(messageID string) error {
+	_, err := mc.db.Exec(query.EnqueueDownload, messageID, time.Now().UnixNano())
+	if err != nil {
+		return fmt.Errorf("failed to queue download: %v", err)
+	}
+	return nil
+}
+
+// QueuedDownloads returns the message IDs of up to limit queued downloads,
+// oldest first. They stay queued until DequeueDownload is called.
+func (mc *MediaCache) QueuedDownloads(limit int) ([]string, error) {
+	rows, err := mc.db.Query(query.SelectQueuedDownloads, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query download queue: %v", err)
+	}
+	defer rows.Close()
+
+	var queued []string
+	for rows.Next() {
+		var messageID string
+		if err := rows.Scan(&messageID); err != nil {
+			return nil, err
+		}
+		queued = append(queued, messageID)
+	}
+	return queued, rows.Err()
+}
+
+// DequeueDownload removes the media of a message from the download queue
+func (mc *MediaCache) DequeueDownload(messageID string) error {
+	_, err := mc.db.Exec(query.DeleteQueuedDownload, messageID)
+	if err != nil {
+		return fmt.Errorf("failed to dequeue download: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,425 @@
+package cache
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lugvitc/whats4linux/internal/migration"
+	query "github.com/lugvitc/whats4linux/internal/query"
+	mtypes "github.com/lugvitc/whats4linux/internal/types"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// imageIndexMigrations is the schema history of idxdb, append only
+var imageIndexMigrations = []migration.Migration{
+	// 1: base schema
+	migration.Exec(query.CreateImageIndexTable),
+	// 2: media of every type, sizes and access times for the quota
+	func(tx *sql.Tx) error {
+		for _, col := range [][2]string{
+			{"media_type", fmt.Sprintf("INTEGER DEFAULT %d", mtypes.MediaTypeImage)},
+			{"size", "INTEGER"},
+			{"last_access", "INTEGER"},
+		} {
+			err := migration.AddColumn("image_index", col[0], col[1])(tx)
+			if err != nil {
+				return err
+			}
+		}
+		return migration.Exec(
+			query.SetImageIndexLastAccess,
+			query.CreateImageIndexLastAccessIndex,
+		)(tx)
+	},
+	// 3: auto-download queue
+	migration.Exec(query.CreateDownloadQueueTable),
+}
+
+// MediaCache is a content-addressed cache of downloaded media. Files are
+// named after the SHA-256 of their content and indexed by message ID in
+// idxdb, messages sharing the same media share the file.
+type MediaCache struct {
+	db       *sql.DB
+	mediaDir string
+	getStmt  *sql.Stmt // Prepared statement for single media retrieval
+	saveStmt *sql.Stmt // Prepared statement for saving media
+
+	// mu serializes the changes to the files on disk, so that the sweeper
+	// never sees a file before its index entry
+	mu sync.Mutex
+	// quota is the maximum size of the cache in bytes, 0 disables it
+	quota int64
+	done  chan struct{}
+}
+
+type MediaMeta struct {
+	MessageID string
+	SHA256    string
+	Mime      string
+	MediaType mtypes.MediaType
+	Width     int
+	Height    int
+	Size      int64
+	CreatedAt int64
+}
+
+// NewMediaCache creates a new media cache instance. quota is the maximum
+// size of the cache in bytes, 0 disables it.
+func NewMediaCache(quota int64) (*MediaCache, error) {
+	cacheDir, err := os.UserCacheDir()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get cache directory: %v", err)
+	}
+
+	baseDir := filepath.Join(cacheDir, "whats4linux")
+	mediaDir := filepath.Join(baseDir, "media")
+	// the cache used to hold images only
+	if _, err := os.Stat(mediaDir); os.IsNotExist(err) {
+		if err := os.Rename(filepath.Join(baseDir, "images"), mediaDir); err != nil && !os.IsNotExist(err) {
+			return nil, fmt.Errorf("failed to move images directory: %v", err)
+		}
+	}
+	if err := os.MkdirAll(mediaDir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create media directory: %v", err)
+	}
+
+	dbPath := filepath.Join(baseDir, "idxdb")
+	if err := os.MkdirAll(filepath.Dir(dbPath), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create idxdb directory: %v", err)
+	}
+
+	db, err := sql.Open("sqlite3", dbPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database: %v", err)
+	}
+
+	if err := migration.Apply(db, "idxdb", imageIndexMigrations); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to initialize schema: %v", err)
+	}
+
+	getStmt, err := db.Prepare(query.GetImageByID)
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to prepare get statement: %v", err)
+	}
+
+	saveStmt, err := db.Prepare(query.SaveImageIndex)
+	if err != nil {
+		getStmt.Close()
+		db.Close()
+		return nil, fmt.Errorf("failed to prepare save statement: %v", err)
+	}
+
+	mc := &MediaCache{
+		db:       db,
+		mediaDir: mediaDir,
+		getStmt:  getStmt,
+		saveStmt: saveStmt,
+		quota:    quota,
+		done:     make(chan struct{}),
+	}
+
+	return mc, nil
+}
+
+func (mc *MediaCache) path(sha, mime string) string {
+	return filepath.Join(mc.mediaDir, sha+MimeToExt(mime))
+}
+
+// partialDir holds the files being downloaded, out of the sweeper's way
+func (mc *MediaCache) partialDir() string {
+	return filepath.Join(mc.mediaDir, "partial")
+}
+
+// CreateTemp creates a file to download media into. It is added to the
+// cache with SaveMediaFile, or must be removed by the caller.
+func (mc *MediaCache) CreateTemp() (*os.File, error) {
+	if err := os.MkdirAll(mc.partialDir(), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create partial directory: %v", err)
+	}
+	return os.CreateTemp(mc.partialDir(), "download-*")
+}
+
+// SaveMedia saves media to cache and creates an index entry, evicting the
+// least recently used files when the cache goes over its quota
+func (mc *MediaCache) SaveMedia(messageID string, data []byte, mime string, mediaType mtypes.MediaType, width, height int) (string, error) {
+	h := sha256.Sum256(data)
+	hashStr := hex.EncodeToString(h[:])
+
+	err := mc.save(messageID, hashStr, mime, mediaType, width, height, int64(len(data)), func(path string) error {
+		return os.WriteFile(path, data, 0644)
+	})
+	if err != nil {
+		return "", err
+	}
+	return hashStr, nil
+}
+
+// SaveMediaFile moves a file created by CreateTemp into the cache, see
+// SaveMedia. The file is closed, and removed when the cache already has it.
+func (mc *MediaCache) SaveMediaFile(messageID string, f *os.File, mime string, mediaType mtypes.MediaType, width, height int) (string, error) {
+	defer os.Remove(f.Name())
+
+	h := sha256.New()
+	var size int64
+	_, err := f.Seek(0, io.SeekStart)
+	if err == nil {
+		size, err = io.Copy(h, f)
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to read media file: %v", err)
+	}
+	hashStr := hex.EncodeToString(h.Sum(nil))
+
+	err = mc.save(messageID, hashStr, mime, mediaType, width, height, size, func(path string) error {
+		return os.Rename(f.Name(), path)
+	})
+	if err != nil {
+		return "", err
+	}
+	return hashStr, nil
+}
+
+// save writes a file with write, unless the cache already has it, and
+// indexes it. Both happen under mc.mu so that the sweeper never sees a file
+// before its index entry.
+func (mc *MediaCache) save(messageID, hashStr, mime string, mediaType mtypes.MediaType, width, height int, size int64, write func(path string) error) error {
+	mc.mu.Lock()
+	path := mc.path(hashStr, mime)
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		if err := write(path); err != nil {
+			mc.mu.Unlock()
+			return fmt.Errorf("failed to write media file: %v", err)
+		}
+	}
+
+	now := time.Now().Unix()
+	_, err := mc.saveStmt.Exec(messageID, hashStr, mime, mediaType, width, height, size, now, now)
+	mc.mu.Unlock()
+	if err != nil {
+		return fmt.Errorf("failed to insert media index: %v", err)
+	}
+
+	return mc.enforceQuota()
+}
+
+func scanMediaMeta(row interface{ Scan(...any) error }) (*MediaMeta, error) {
+	var (
+		meta      MediaMeta
+		mediaType sql.NullInt64
+		mime      sql.NullString
+		w, h      sql.NullInt64
+		createdAt sql.NullInt64
+	)
+	err := row.Scan(
+		&meta.MessageID,
+		&meta.SHA256,
+		&mime,
+		&mediaType,
+		&w,
+		&h,
+		&meta.Size,
+		&createdAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	meta.Mime = mime.String
+	meta.MediaType = mtypes.MediaType(mediaType.Int64)
+	meta.Width, meta.Height = int(w.Int64), int(h.Int64)
+	meta.CreatedAt = createdAt.Int64
+	return &meta, nil
+}
+
+// GetMediaByMessageID retrieves media metadata by message ID
+func (mc *MediaCache) GetMediaByMessageID(messageID string) (*MediaMeta, error) {
+	meta, err := scanMediaMeta(mc.getStmt.QueryRow(messageID))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return meta, err
+}
+
+// GetMediaByMessageIDs retrieves multiple media metadata by message IDs (batch)
+func (mc *MediaCache) GetMediaByMessageIDs(messageIDs []string) (map[string]*MediaMeta, error) {
+	if len(messageIDs) == 0 {
+		return make(map[string]*MediaMeta), nil
+	}
+
+	placeholders := make([]string, len(messageIDs))
+	args := make([]any, len(messageIDs))
+	for i, id := range messageIDs {
+		placeholders[i] = "?"
+		args[i] = id
+	}
+
+	q := query.GetImagesByIDsPrefix + strings.Join(placeholders, ",") + ")"
+	rows, err := mc.db.Query(q, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	result := make(map[string]*MediaMeta, len(messageIDs))
+	for rows.Next() {
+		meta, err := scanMediaMeta(rows)
+		if err != nil {
+			return nil, err
+		}
+		result[meta.MessageID] = meta
+	}
+	return result, rows.Err()
+}
+
+// GetMediaFilePath returns the file name of cached media by message ID
+func (mc *MediaCache) GetMediaFilePath(messageID string) (string, error) {
+	meta, err := mc.GetMediaByMessageID(messageID)
+	if err != nil {
+		return "", err
+	}
+	if meta == nil {
+		return "", fmt.Errorf("media not found for message ID: %s", messageID)
+	}
+
+	return meta.SHA256 + MimeToExt(meta.Mime), nil
+}
+
+// ReadMediaByMessageID reads cached media by message ID, marking it as
+// recently used
+func (mc *MediaCache) ReadMediaByMessageID(messageID string) ([]byte, string, error) {
+	meta, err := mc.GetMediaByMessageID(messageID)
+	if err != nil {
+		return nil, "", err
+	}
+	if meta == nil {
+		return nil, "", fmt.Errorf("media not found for message ID: %s", messageID)
+	}
+
+	data, err := os.ReadFile(mc.path(meta.SHA256, meta.Mime))
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to read media file: %v", err)
+	}
+
+	_, err = mc.db.Exec(query.TouchImageIndex, time.Now().Unix(), messageID)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to update media index: %v", err)
+	}
+
+	return data, meta.Mime, nil
+}
+
+// OpenMedia opens cached media by message ID for streaming, marking it as
+// recently used. It returns a nil file when the media isn't cached.
+func (mc *MediaCache) OpenMedia(messageID string) (*os.File, *MediaMeta, error) {
+	meta, err := mc.GetMediaByMessageID(messageID)
+	if err != nil || meta == nil {
+		return nil, nil, err
+	}
+
+	f, err := os.Open(mc.path(meta.SHA256, meta.Mime))
+	if os.IsNotExist(err) {
+		// swept from under the index, the sweeper drops the entry
+		return nil, nil, nil
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to open media file: %v", err)
+	}
+
+	_, err = mc.db.Exec(query.TouchImageIndex, time.Now().Unix(), messageID)
+	if err != nil {
+		f.Close()
+		return nil, nil, fmt.Errorf("failed to update media index: %v", err)
+	}
+
+	return f, meta, nil
+}
+
+// SaveAvatar saves an avatar image to cache using JID as the key
+func (mc *MediaCache) SaveAvatar(jid string, data []byte, mime string) (string, error) {
+	avatarKey := "avatar_" + jid
+	return mc.SaveMedia(avatarKey, data, mime, mtypes.MediaTypeImage, 0, 0)
+}
+
+// DeleteAvatar deletes an avatar image from cache by JID. The file is left
+// to the sweeper, other entries may share it.
+func (mc *MediaCache) DeleteAvatar(jid string) error {
+	avatarKey := "avatar_" + jid
+	_, err := mc.db.Exec(query.DeleteImageIndex, avatarKey)
+	if err != nil {
+		return fmt.Errorf("failed to delete avatar index: %v", err)
+	}
+
+	return nil
+}
+
+// GetAvatarFilePath returns the file path for a cached avatar by JID
+func (mc *MediaCache) GetAvatarFilePath(jid string) (string, error) {
+	avatarKey := "avatar_" + jid
+	return mc.GetMediaFilePath(avatarKey)
+}
+
+// ReadAvatarByJID reads an avatar image by JID
+func (mc *MediaCache) ReadAvatarByJID(jid string) ([]byte, string, error) {
+	avatarKey := "avatar_" + jid
+	return mc.ReadMediaByMessageID(avatarKey)
+}
+
+// OpenAvatar opens a cached avatar by JID, see OpenMedia
+func (mc *MediaCache) OpenAvatar(jid string) (*os.File, *MediaMeta, error) {
+	avatarKey := "avatar_" + jid
+	return mc.OpenMedia(avatarKey)
+}
+
+// Close stops the sweeper and closes the database connection and prepared statements
+func (mc *MediaCache) Close() error {
+	close(mc.done)
+	if mc.getStmt != nil {
+		mc.getStmt.Close()
+	}
+	if mc.saveStmt != nil {
+		mc.saveStmt.Close()
+	}
+	return mc.db.Close()
+}
+
+// MimeToExt returns the file extension used for cached media of the given
+// mime type. Images of unknown types keep the .jpg extension they have
+// always been saved with.
+func MimeToExt(mime string) string {
+	switch mime {
+	case "image/png":
+		return ".png"
+	case "image/gif":
+		return ".gif"
+	case "image/webp":
+		return ".webp"
+	case "video/mp4":
+		return ".mp4"
+	case "video/3gpp":
+		return ".3gp"
+	case "audio/ogg", "audio/ogg; codecs=opus":
+		return ".ogg"
+	case "audio/mpeg":
+		return ".mp3"
+	case "audio/mp4", "audio/aac":
+		return ".m4a"
+	case "application/pdf":
+		return ".pdf"
+	}
+	if mime == "" || strings.HasPrefix(mime, "image/") {
+		return ".jpg"
+	}
+	return ".bin"
+}
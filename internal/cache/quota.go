@@ -0,0 +1,243 @@
+package cache
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	query "github.com/lugvitc/whats4linux/internal/query"
+)
+
+const (
+	// sweepInterval is how often the sweeper looks for orphaned files
+	sweepInterval = time.Hour
+	// evictBatch is the number of files considered per eviction query
+	evictBatch = 64
+	// partialMaxAge is the age past which a partial download was abandoned
+	partialMaxAge = 24 * time.Hour
+)
+
+// Usage is the disk usage of the media cache
+type Usage struct {
+	Files int   `json:"files"`
+	Size  int64 `json:"size"`
+	// Quota is the maximum size of the cache in bytes, 0 when unlimited
+	Quota int64 `json:"quota"`
+}
+
+// Usage returns the number of cached files and their total size
+func (mc *MediaCache) Usage() (Usage, error) {
+	usage := Usage{Quota: mc.quota}
+	err := mc.db.QueryRow(query.SelectCacheUsage).Scan(&usage.Files, &usage.Size)
+	return usage, err
+}
+
+// enforceQuota evicts the least recently used files until the cache fits in
+// its quota
+func (mc *MediaCache) enforceQuota() error {
+	if mc.quota <= 0 {
+		return nil
+	}
+
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
+
+	for {
+		usage, err := mc.Usage()
+		if err != nil {
+			return err
+		}
+		if usage.Size <= mc.quota {
+			return nil
+		}
+
+		rows, err := mc.db.Query(query.SelectLeastRecentlyUsedFiles, evictBatch)
+		if err != nil {
+			return err
+		}
+		type file struct {
+			sha, mime string
+			size      int64
+		}
+		var lru []file
+		for rows.Next() {
+			var f file
+			if err := rows.Scan(&f.sha, &f.mime, &f.size); err != nil {
+				rows.Close()
+				return err
+			}
+			lru = append(lru, f)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+		if len(lru) == 0 {
+			return nil
+		}
+
+		excess := usage.Size - mc.quota
+		for _, f := range lru {
+			if excess <= 0 {
+				break
+			}
+			if err := mc.removeFile(f.sha, f.mime); err != nil {
+				return err
+			}
+			excess -= f.size
+		}
+	}
+}
+
+// removeFile deletes a cached file and every index entry pointing to it
+func (mc *MediaCache) removeFile(sha, mime string) error {
+	_, err := mc.db.Exec(query.DeleteImageIndexBySHA, sha)
+	if err != nil {
+		return fmt.Errorf("failed to delete media index: %v", err)
+	}
+	err = os.Remove(mc.path(sha, mime))
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to delete media file: %v", err)
+	}
+	return nil
+}
+
+// Clear removes every cached file
+func (mc *MediaCache) Clear() error {
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
+
+	_, err := mc.db.Exec(query.DeleteAllImageIndex)
+	if err != nil {
+		return fmt.Errorf("failed to clear media index: %v", err)
+	}
+	entries, err := os.ReadDir(mc.mediaDir)
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		if e.IsDir() {
+			continue
+		}
+		err := os.Remove(filepath.Join(mc.mediaDir, e.Name()))
+		if err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to delete media file: %v", err)
+		}
+	}
+	return nil
+}
+
+// StartSweeper periodically sweeps orphaned files and enforces the quota
+// until the cache is closed. Only the process owning the cache should run it.
+func (mc *MediaCache) StartSweeper() {
+	go mc.runSweeper()
+}
+
+func (mc *MediaCache) runSweeper() {
+	ticker := time.NewTicker(sweepInterval)
+	defer ticker.Stop()
+
+	for {
+		if err := mc.Sweep(); err != nil {
+			log.Println("Media cache sweep failed:", err)
+		}
+		if err := mc.enforceQuota(); err != nil {
+			log.Println("Media cache eviction failed:", err)
+		}
+		select {
+		case <-ticker.C:
+		case <-mc.done:
+			return
+		}
+	}
+}
+
+// Sweep deletes the files on disk that no index entry points to and the
+// abandoned partial downloads, drops the entries whose file is gone, and
+// records the size of entries that predate size tracking
+func (mc *MediaCache) Sweep() error {
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
+
+	rows, err := mc.db.Query(query.SelectIndexedFiles)
+	if err != nil {
+		return err
+	}
+	type file struct {
+		sha, mime string
+		noSize    bool
+	}
+	indexed := make(map[string]file)
+	for rows.Next() {
+		var f file
+		if err := rows.Scan(&f.sha, &f.mime, &f.noSize); err != nil {
+			rows.Close()
+			return err
+		}
+		indexed[f.sha+MimeToExt(f.mime)] = f
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	entries, err := os.ReadDir(mc.mediaDir)
+	if err != nil {
+		return err
+	}
+	var removed int
+	for _, e := range entries {
+		if e.IsDir() {
+			continue
+		}
+		f, ok := indexed[e.Name()]
+		if !ok {
+			if err := os.Remove(filepath.Join(mc.mediaDir, e.Name())); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+			removed++
+			continue
+		}
+		delete(indexed, e.Name())
+
+		if f.noSize {
+			info, err := e.Info()
+			if err != nil {
+				return err
+			}
+			if _, err := mc.db.Exec(query.UpdateImageIndexSize, info.Size(), f.sha); err != nil {
+				return err
+			}
+		}
+	}
+
+	// what's left is indexed but missing on disk
+	for _, f := range indexed {
+		if _, err := mc.db.Exec(query.DeleteImageIndexBySHA, f.sha); err != nil {
+			return err
+		}
+	}
+
+	// downloads interrupted by a crash
+	partials, err := os.ReadDir(mc.partialDir())
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	for _, e := range partials {
+		info, err := e.Info()
+		if err != nil || time.Since(info.ModTime()) < partialMaxAge {
+			continue
+		}
+		if err := os.Remove(filepath.Join(mc.partialDir(), e.Name())); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		removed++
+	}
+
+	if removed > 0 || len(indexed) > 0 {
+		log.Printf("Media cache sweep removed %d orphaned files and %d missing entries\n", removed, len(indexed))
+	}
+	return nil
+}
@@ -0,0 +1,211 @@
+package export
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/lugvitc/whats4linux/internal/cache"
+	"github.com/lugvitc/whats4linux/internal/store"
+	"github.com/nyaruka/phonenumbers"
+	wastore "go.mau.fi/whatsmeow/store"
+	"go.mau.fi/whatsmeow/types"
+)
+
+// pageSize is the number of messages read from messages.db at once
+const pageSize = 500
+
+// Format is the file format of an export
+type Format string
+
+const (
+	// FormatText is a zip archive of the chat log in the format of the
+	// official apps and its media
+	FormatText Format = "text"
+	// FormatJSON is a versioned JSON document, see ChatRecord
+	FormatJSON Format = "json"
+	// FormatHTML is a standalone HTML transcript
+	FormatHTML Format = "html"
+)
+
+// Ext returns the file extension of exports in the format
+func (f Format) Ext() string {
+	switch f {
+	case FormatJSON:
+		return ".json"
+	case FormatHTML:
+		return ".html"
+	default:
+		return ".zip"
+	}
+}
+
+// Options configures a chat export
+type Options struct {
+	// Format defaults to FormatText
+	Format Format `json:"format,omitempty"`
+	// Path of the file to write
+	Path string `json:"path"`
+	// Title of the chat, shown in HTML exports
+	Title string `json:"title,omitempty"`
+	// IncludeMedia adds the downloaded media of the chat to the export
+	IncludeMedia bool `json:"include_media"`
+	// After and Before restrict the export to a time range, as unix
+	// timestamps (inclusive). Zero values disable them.
+	After  int64 `json:"after,omitempty"`
+	Before int64 `json:"before,omitempty"`
+}
+
+// Exporter writes chat logs stored in messages.db to files
+type Exporter struct {
+	messages *store.MessageStore
+	images   *cache.MediaCache
+	contacts wastore.ContactStore
+	// selfName is the name used for our own messages
+	selfName string
+
+	names map[string]string
+}
+
+func New(messages *store.MessageStore, images *cache.MediaCache, contacts wastore.ContactStore, selfName string) *Exporter {
+	if selfName == "" {
+		selfName = "You"
+	}
+	return &Exporter{
+		messages: messages,
+		images:   images,
+		contacts: contacts,
+		selfName: selfName,
+		names:    make(map[string]string),
+	}
+}
+
+// Export writes a chat in the format selected by opts
+func (e *Exporter) Export(ctx context.Context, chatJID string, opts Options) error {
+	switch opts.Format {
+	case FormatText, "":
+		return e.ExportText(ctx, chatJID, opts)
+	case FormatJSON:
+		return e.ExportJSON(ctx, chatJID, opts)
+	case FormatHTML:
+		return e.ExportHTML(ctx, chatJID, opts)
+	default:
+		return fmt.Errorf("unknown export format %q", opts.Format)
+	}
+}
+
+// chatMessages returns the messages of a chat within the range of opts,
+// oldest first
+func (e *Exporter) chatMessages(chatJID string, opts Options) ([]store.DecodedMessage, error) {
+	var (
+		pages  [][]store.DecodedMessage
+		seen   = make(map[string]bool)
+		before int64
+	)
+	for {
+		page, err := e.messages.GetDecodedMessagesPaged(chatJID, before, pageSize)
+		if err != nil {
+			return nil, err
+		}
+
+		// pages are split on timestamps, the next page starts at the second the
+		// current one ends with so that messages sharing it aren't skipped
+		fresh := page[:0]
+		for _, msg := range page {
+			if !seen[msg.Info.ID] {
+				seen[msg.Info.ID] = true
+				fresh = append(fresh, msg)
+			}
+		}
+		if len(fresh) == 0 {
+			break
+		}
+		pages = append(pages, fresh)
+
+		oldest := messageTime(fresh[0]).Unix()
+		if len(page) < pageSize || (opts.After != 0 && oldest < opts.After) {
+			break
+		}
+		before = oldest + 1
+	}
+
+	var msgs []store.DecodedMessage
+	for _, page := range slices.Backward(pages) {
+		for _, msg := range page {
+			ts := messageTime(msg).Unix()
+			if opts.After != 0 && ts < opts.After {
+				continue
+			}
+			if opts.Before != 0 && ts > opts.Before {
+				continue
+			}
+			msgs = append(msgs, msg)
+		}
+	}
+	return msgs, nil
+}
+
+// senderName resolves the name shown for the sender of a message
+func (e *Exporter) senderName(ctx context.Context, msg *store.DecodedMessage) string {
+	if msg.Info.IsFromMe {
+		return e.selfName
+	}
+	if name, ok := e.names[msg.Info.Sender]; ok {
+		return name
+	}
+
+	jid, err := types.ParseJID(msg.Info.Sender)
+	if err != nil {
+		return msg.Info.Sender
+	}
+	name := formatPhoneNumber(jid.User)
+	// there's no contact store without a logged in session
+	if e.contacts != nil {
+		contact, err := e.contacts.GetContact(ctx, jid.ToNonAD())
+		if err == nil {
+			for _, n := range []string{contact.FullName, contact.FirstName, contact.PushName, contact.BusinessName} {
+				if n != "" {
+					name = n
+					break
+				}
+			}
+		}
+	}
+	e.names[msg.Info.Sender] = name
+	return name
+}
+
+// formatPhoneNumber formats a JID user the way WhatsApp shows unknown numbers
+func formatPhoneNumber(user string) string {
+	num, err := phonenumbers.Parse("+"+user, "")
+	if err != nil {
+		return "+" + user
+	}
+	return phonenumbers.Format(num, phonenumbers.INTERNATIONAL)
+}
+
+func messageTime(msg store.DecodedMessage) time.Time {
+	ts, _ := time.Parse(time.RFC3339, msg.Info.Timestamp)
+	return ts
+}
+
+// messageText returns the raw text of a decoded message, its caption for
+// media messages
+func messageText(msg *store.DecodedMessage) string {
+	return strings.TrimSpace(msg.Text)
+}
+
+// mediaMime returns the mime type of the downloaded media of a message, media
+// is only on disk once it has been downloaded
+func (e *Exporter) mediaMime(messageID string) (string, bool) {
+	if e.images == nil {
+		return "", false
+	}
+	meta, err := e.images.GetMediaByMessageID(messageID)
+	if err != nil || meta == nil {
+		return "", false
+	}
+	return meta.Mime, true
+}
@@ -0,0 +1,129 @@
+package export
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"html/template"
+	"os"
+	"time"
+
+	mtypes "github.com/lugvitc/whats4linux/internal/types"
+)
+
+// htmlTemplate renders a standalone transcript, everything it needs
+// (styles, images) is inlined so it can be opened offline
+var htmlTemplate = template.Must(template.New("chat").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>{{.Title}}</title>
+<style>
+body { margin: 0; background: #efeae2; font-family: system-ui, sans-serif; font-size: 14px; color: #111b21; }
+header { position: sticky; top: 0; padding: 12px 20px; background: #008069; color: #fff; }
+header h1 { margin: 0; font-size: 18px; }
+header p { margin: 2px 0 0; font-size: 12px; opacity: .8; }
+main { max-width: 860px; margin: 0 auto; padding: 16px; }
+.msg { max-width: 75%; margin: 4px 0; padding: 6px 9px; border-radius: 8px; background: #fff; clear: both; float: left; }
+.msg.me { float: right; background: #d9fdd3; }
+.sender { font-weight: 600; font-size: 12.5px; color: #027eb5; }
+.meta { font-size: 11px; color: #667781; text-align: right; }
+.text { white-space: pre-wrap; word-wrap: break-word; }
+.deleted { font-style: italic; color: #667781; }
+.tag { font-size: 11px; color: #667781; font-style: italic; }
+.reply { display: block; color: inherit; text-decoration: none; margin-bottom: 4px; padding: 4px 8px; border-left: 3px solid #06cf9c; background: rgba(0,0,0,.05); border-radius: 4px; font-size: 12.5px; }
+.reactions { font-size: 13px; }
+.media { color: #667781; }
+img { display: block; max-width: 100%; max-height: 360px; border-radius: 6px; }
+.clear { clear: both; }
+</style>
+</head>
+<body>
+<header>
+<h1>{{.Title}}</h1>
+<p>Exported on {{.ExportedAt}}, {{len .Messages}} messages</p>
+</header>
+<main>
+{{range .Messages}}<div class="msg{{if .Record.FromMe}} me{{end}}" id="{{.Record.ID}}">
+{{if not .Record.FromMe}}<div class="sender">{{.Record.SenderName}}</div>
+{{end}}{{if .Record.Forwarded}}<div class="tag">Forwarded</div>
+{{end}}{{if .ReplyText}}<a class="reply" href="#{{.Record.ReplyTo}}">{{.ReplyText}}</a>
+{{end}}{{if .Record.Deleted}}<div class="deleted">This message was deleted.</div>
+{{else}}{{if .Image}}<img src="{{.Image}}" alt="{{.Record.Type}}">
+{{else if .Record.Media}}<div class="media">[{{.Record.Type}}{{with .Record.Media.FileName}}: {{.}}{{end}}]</div>
+{{end}}{{with .Record.Text}}<div class="text">{{.}}</div>
+{{end}}{{end}}{{if .Record.Reactions}}<div class="reactions">{{range .Record.Reactions}}{{.Emoji}}{{end}}</div>
+{{end}}<div class="meta">{{if .Record.Edited}}edited · {{end}}{{.Time}}</div>
+</div>
+{{end}}<div class="clear"></div>
+</main>
+</body>
+</html>
+`))
+
+type htmlMessage struct {
+	Record    MessageRecord
+	Time      string
+	ReplyText string
+	// Image is a data URL of the downloaded image or sticker
+	Image template.URL
+}
+
+// ExportHTML writes a chat as a standalone HTML transcript. Downloaded
+// images and stickers are embedded when opts.IncludeMedia is set.
+func (e *Exporter) ExportHTML(ctx context.Context, chatJID string, opts Options) error {
+	msgs, err := e.chatMessages(chatJID, opts)
+	if err != nil {
+		return fmt.Errorf("failed to read messages: %w", err)
+	}
+	record := e.chatRecord(ctx, chatJID, msgs)
+
+	texts := make(map[string]string, len(record.Messages))
+	for _, mr := range record.Messages {
+		texts[mr.ID] = mr.Text
+	}
+
+	page := struct {
+		Title      string
+		ExportedAt string
+		Messages   []htmlMessage
+	}{
+		Title:      opts.Title,
+		ExportedAt: time.Unix(record.ExportedAt, 0).Format("02/01/2006, 15:04"),
+		Messages:   make([]htmlMessage, 0, len(record.Messages)),
+	}
+	if page.Title == "" {
+		page.Title = chatJID
+	}
+
+	for _, mr := range record.Messages {
+		hm := htmlMessage{
+			Record: mr,
+			Time:   time.Unix(mr.Timestamp, 0).Format("02/01/2006, 15:04"),
+		}
+		if mr.ReplyTo != "" {
+			hm.ReplyText = texts[mr.ReplyTo]
+		}
+		// other media would be broken images, and can be far too large to
+		// inline; they are listed with their name instead
+		isImage := mr.Type == messageTypeNames[mtypes.MediaTypeImage] || mr.Type == messageTypeNames[mtypes.MediaTypeSticker]
+		if opts.IncludeMedia && isImage && mr.Media != nil && mr.Media.Downloaded {
+			data, mime, err := e.images.ReadMediaByMessageID(mr.ID)
+			if err == nil {
+				hm.Image = template.URL(fmt.Sprintf("data:%s;base64,%s", mime, base64.StdEncoding.EncodeToString(data)))
+			}
+		}
+		page.Messages = append(page.Messages, hm)
+	}
+
+	f, err := os.Create(opts.Path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if err := htmlTemplate.Execute(f, page); err != nil {
+		return err
+	}
+	return f.Close()
+}
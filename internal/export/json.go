@@ -0,0 +1,159 @@
+package export
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/lugvitc/whats4linux/internal/store"
+	mtypes "github.com/lugvitc/whats4linux/internal/types"
+)
+
+// SchemaVersion is the version of the JSON export schema. It is bumped on
+// every change that isn't a pure addition of fields.
+const SchemaVersion = 1
+
+var messageTypeNames = map[mtypes.MediaType]string{
+	mtypes.MediaTypeNone:     "text",
+	mtypes.MediaTypeImage:    "image",
+	mtypes.MediaTypeVideo:    "video",
+	mtypes.MediaTypeAudio:    "audio",
+	mtypes.MediaTypeDocument: "document",
+	mtypes.MediaTypeSticker:  "sticker",
+}
+
+// ChatRecord is the root of a JSON export
+type ChatRecord struct {
+	Version    int             `json:"version"`
+	ExportedAt int64           `json:"exported_at"`
+	ChatJID    string          `json:"chat_jid"`
+	Messages   []MessageRecord `json:"messages"`
+}
+
+// MessageRecord is a single exported message. Timestamps are unix seconds.
+type MessageRecord struct {
+	ID         string           `json:"id"`
+	Timestamp  int64            `json:"timestamp"`
+	SenderJID  string           `json:"sender_jid"`
+	SenderName string           `json:"sender_name"`
+	FromMe     bool             `json:"from_me"`
+	Type       string           `json:"type"`
+	Text       string           `json:"text"`
+	ReplyTo    string           `json:"reply_to,omitempty"`
+	Forwarded  bool             `json:"forwarded"`
+	Edited     bool             `json:"edited"`
+	Deleted    bool             `json:"deleted"`
+	Edits      []EditRecord     `json:"edits,omitempty"`
+	Reactions  []ReactionRecord `json:"reactions,omitempty"`
+	Media      *MediaRecord     `json:"media,omitempty"`
+}
+
+// EditRecord is a prior version of an edited message
+type EditRecord struct {
+	Text      string `json:"text"`
+	Timestamp int64  `json:"timestamp"`
+	EditedAt  int64  `json:"edited_at"`
+}
+
+type ReactionRecord struct {
+	SenderJID string `json:"sender_jid"`
+	Emoji     string `json:"emoji"`
+}
+
+// MediaRecord describes the media of a message, Downloaded is set when the
+// media is available locally
+type MediaRecord struct {
+	Mimetype   string `json:"mimetype,omitempty"`
+	FileName   string `json:"file_name,omitempty"`
+	Width      int    `json:"width,omitempty"`
+	Height     int    `json:"height,omitempty"`
+	Downloaded bool   `json:"downloaded"`
+}
+
+// chatRecord converts the messages of a chat into their export records
+func (e *Exporter) chatRecord(ctx context.Context, chatJID string, msgs []store.DecodedMessage) ChatRecord {
+	record := ChatRecord{
+		Version:    SchemaVersion,
+		ExportedAt: time.Now().Unix(),
+		ChatJID:    chatJID,
+		Messages:   make([]MessageRecord, 0, len(msgs)),
+	}
+	for i := range msgs {
+		record.Messages = append(record.Messages, e.messageRecord(ctx, chatJID, &msgs[i]))
+	}
+	return record
+}
+
+func (e *Exporter) messageRecord(ctx context.Context, chatJID string, msg *store.DecodedMessage) MessageRecord {
+	mr := MessageRecord{
+		ID:         msg.Info.ID,
+		Timestamp:  messageTime(*msg).Unix(),
+		SenderJID:  msg.Info.Sender,
+		SenderName: e.senderName(ctx, msg),
+		FromMe:     msg.Info.IsFromMe,
+		Type:       messageTypeNames[msg.Type],
+		Text:       messageText(msg),
+		ReplyTo:    msg.ReplyToMessageID,
+		Forwarded:  msg.Forwarded,
+		Edited:     msg.Edited,
+		Deleted:    msg.Deleted,
+	}
+	if mr.Type == "" {
+		mr.Type = "unknown"
+	}
+
+	for _, r := range msg.Reactions {
+		mr.Reactions = append(mr.Reactions, ReactionRecord{SenderJID: r.SenderID, Emoji: r.Emoji})
+	}
+
+	if msg.Edited {
+		edits, err := e.messages.GetMessageEditHistory(chatJID, msg.Info.ID)
+		if err == nil {
+			for _, edit := range edits {
+				mr.Edits = append(mr.Edits, EditRecord{
+					Text:      edit.Text,
+					Timestamp: edit.Timestamp,
+					EditedAt:  edit.EditedAt,
+				})
+			}
+		}
+	}
+
+	if msg.Type != mtypes.MediaTypeNone && !msg.Deleted {
+		media := &MediaRecord{}
+		if c := msg.Content; c != nil && c.DocumentMessage != nil {
+			media.FileName = c.DocumentMessage.FileName
+		}
+		full, err := e.messages.GetMessageWithMedia(chatJID, msg.Info.ID)
+		if err == nil && full.Media != nil {
+			media.Mimetype = full.Media.GetMimetype()
+			media.Width, media.Height = full.Media.GetDimensions()
+		}
+		_, media.Downloaded = e.mediaMime(msg.Info.ID)
+		mr.Media = media
+	}
+	return mr
+}
+
+// ExportJSON writes a chat as a single JSON document, see ChatRecord
+func (e *Exporter) ExportJSON(ctx context.Context, chatJID string, opts Options) error {
+	msgs, err := e.chatMessages(chatJID, opts)
+	if err != nil {
+		return fmt.Errorf("failed to read messages: %w", err)
+	}
+
+	f, err := os.Create(opts.Path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	enc := json.NewEncoder(f)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(e.chatRecord(ctx, chatJID, msgs)); err != nil {
+		return err
+	}
+	return f.Close()
+}
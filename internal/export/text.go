@@ -0,0 +1,124 @@
+package export
+
+import (
+	"archive/zip"
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/lugvitc/whats4linux/internal/cache"
+	mtypes "github.com/lugvitc/whats4linux/internal/types"
+)
+
+// textChatFile is the name of the chat log inside the archive, as written by
+// the official apps
+const textChatFile = "_chat.txt"
+
+var mediaKinds = map[mtypes.MediaType]string{
+	mtypes.MediaTypeImage:    "PHOTO",
+	mtypes.MediaTypeVideo:    "VIDEO",
+	mtypes.MediaTypeAudio:    "AUDIO",
+	mtypes.MediaTypeDocument: "DOCUMENT",
+	mtypes.MediaTypeSticker:  "STICKER",
+}
+
+var omittedMedia = map[mtypes.MediaType]string{
+	mtypes.MediaTypeImage:    "image omitted",
+	mtypes.MediaTypeVideo:    "video omitted",
+	mtypes.MediaTypeAudio:    "audio omitted",
+	mtypes.MediaTypeDocument: "document omitted",
+	mtypes.MediaTypeSticker:  "sticker omitted",
+}
+
+// ExportText writes a chat as a zip archive holding the chat log in the
+// "[date, time] Name: text" format of the official apps, along with the
+// downloaded media of the chat when opts.IncludeMedia is set
+func (e *Exporter) ExportText(ctx context.Context, chatJID string, opts Options) error {
+	msgs, err := e.chatMessages(chatJID, opts)
+	if err != nil {
+		return fmt.Errorf("failed to read messages: %w", err)
+	}
+
+	f, err := os.Create(opts.Path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	zw := zip.NewWriter(f)
+	chatFile, err := zw.Create(textChatFile)
+	if err != nil {
+		return err
+	}
+
+	// media files are added after the chat log is complete, zip entries
+	// can't be written concurrently
+	type attachment struct {
+		name      string
+		messageID string
+	}
+	var attachments []attachment
+
+	w := bufio.NewWriter(chatFile)
+	for i := range msgs {
+		msg := &msgs[i]
+		ts := messageTime(*msg).Local()
+		text := messageText(msg)
+
+		var body string
+		switch {
+		case msg.Deleted:
+			body = "This message was deleted."
+		case msg.Type != mtypes.MediaTypeNone:
+			body = omittedMedia[msg.Type]
+			if opts.IncludeMedia {
+				if mime, ok := e.mediaMime(msg.Info.ID); ok {
+					name := fmt.Sprintf("%08d-%s-%s%s", len(attachments)+1, mediaKinds[msg.Type], ts.Format("2006-01-02-15-04-05"), cache.MimeToExt(mime))
+					attachments = append(attachments, attachment{name: name, messageID: msg.Info.ID})
+					body = "<attached: " + name + ">"
+				}
+			}
+			if text != "" {
+				body += "\n" + text
+			}
+		default:
+			body = text
+		}
+		if msg.Edited && !msg.Deleted {
+			body += " <This message was edited>"
+		}
+
+		_, err = fmt.Fprintf(w, "[%s] %s: %s\n", ts.Format("02/01/2006, 15:04:05"), e.senderName(ctx, msg), normalizeNewlines(body))
+		if err != nil {
+			return err
+		}
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	for _, a := range attachments {
+		data, _, err := e.images.ReadMediaByMessageID(a.messageID)
+		if err != nil {
+			return err
+		}
+		mf, err := zw.Create(a.name)
+		if err != nil {
+			return err
+		}
+		if _, err := mf.Write(data); err != nil {
+			return err
+		}
+	}
+
+	if err := zw.Close(); err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+func normalizeNewlines(s string) string {
+	return strings.ReplaceAll(s, "\r\n", "\n")
+}
@@ -0,0 +1,108 @@
+package markdown
+
+import (
+	"html"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// linkRegex matches the links WhatsApp highlights: URLs, email addresses and
+// international phone numbers. Surrounding punctuation is trimmed by trimLink.
+var linkRegex = regexp.MustCompile(`(?i)(?P<url>\b(?:https?://|www\.)[^\s<>"]+)` +
+	`|(?P<email>\b[a-z0-9._%+-]+@[a-z0-9-]+(?:\.[a-z0-9-]+)*\.[a-z]{2,}\b)` +
+	`|(?P<phone>\+\d[\d \-]{5,}\d)`)
+
+// trailingPunct is punctuation that ends a sentence rather than a link
+const trailingPunct = ".,;:!?'\"*_~"
+
+// trimLink drops trailing punctuation, and closing brackets that have no
+// opening one in the link
+func trimLink(s string) string {
+	for s != "" {
+		last := s[len(s)-1]
+		switch {
+		case strings.IndexByte(trailingPunct, last) >= 0:
+			s = s[:len(s)-1]
+		case last == ')' && strings.Count(s, "(") < strings.Count(s, ")"):
+			s = s[:len(s)-1]
+		default:
+			return s
+		}
+	}
+	return s
+}
+
+// webHref returns the URL a web link points to, links without a scheme
+// ("www.") are https
+func webHref(link string) string {
+	lower := strings.ToLower(link)
+	if strings.HasPrefix(lower, "http://") || strings.HasPrefix(lower, "https://") {
+		return link
+	}
+	return "https://" + link
+}
+
+func linkAtom(href, text string) item {
+	return item{atom: `<a href="` + html.EscapeString(href) + `" target="_blank" rel="noopener noreferrer">` + html.EscapeString(text) + `</a>`}
+}
+
+// linkItems splits a run of plain text into runes and link atoms
+func linkItems(s string) []item {
+	var items []item
+	last := 0
+	for _, m := range linkRegex.FindAllStringSubmatchIndex(s, -1) {
+		start, end := m[0], m[1]
+		prev, _ := utf8.DecodeLastRuneInString(s[:start])
+
+		var link item
+		switch {
+		case m[2] >= 0:
+			text := trimLink(s[start:end])
+			end = start + len(text)
+			link = linkAtom(webHref(text), text)
+		case m[4] >= 0:
+			// a mention or a word glued to the address isn't an email
+			if prev == '@' {
+				continue
+			}
+			text := s[start:end]
+			link = linkAtom("mailto:"+text, text)
+		default:
+			// phone numbers must stand on their own
+			next, _ := utf8.DecodeRuneInString(s[end:])
+			if (start > 0 && (isWord(prev) || prev == '@' || prev == '/')) || isWord(next) {
+				continue
+			}
+			text := strings.TrimRightFunc(s[start:end], unicode.IsSpace)
+			digits := strings.Map(func(r rune) rune {
+				if unicode.IsDigit(r) {
+					return r
+				}
+				return -1
+			}, text)
+			if len(digits) < 7 || len(digits) > 15 {
+				continue
+			}
+			link = linkAtom("tel:+"+digits, text)
+		}
+
+		items = append(items, runeItems(s[last:start])...)
+		items = append(items, link)
+		last = end
+	}
+	return append(items, runeItems(s[last:])...)
+}
+
+// ExtractLinks returns the web links in a text, as the URLs they point to
+func ExtractLinks(text string) []string {
+	var links []string
+	for _, m := range linkRegex.FindAllStringSubmatchIndex(text, -1) {
+		if m[2] < 0 {
+			continue
+		}
+		links = append(links, webHref(trimLink(text[m[0]:m[1]])))
+	}
+	return links
+}
@@ -1,20 +1,26 @@
 package markdown
 
-// TODO :  URL parsing, triple backtick blocks
 import (
 	"html"
+	"regexp"
 	"strings"
 	"unicode"
 	"unicode/utf8"
 )
 
-var Tokens = map[string]string{
-	"*": "b",
-	"`": "span class=\"inline-code\"",
-	"_": "i",
-	"~": "s",
+// Tokens maps the style markers to the tags they render as. Styles can nest
+// but don't span lines, code (see codeMarker) is never styled.
+var Tokens = map[rune]string{
+	'*': "b",
+	'_': "i",
+	'~': "s",
 }
 
+const (
+	codeMarker  = "`"
+	blockMarker = "```"
+)
+
 func openTag(tag string) string {
 	return "<" + tag + ">"
 }
@@ -27,88 +33,182 @@ func isWord(r rune) bool {
 	return unicode.IsLetter(r) || unicode.IsDigit(r)
 }
 
-// inline parser
-func ParseInline(s string) string {
-	var out strings.Builder
-	var buf strings.Builder
-	var active string
-	var openPos int
-	var lastClose int = -1
+// item is a single rune of a line, or an atom that was already rendered
+// (code spans, links) and is never styled
+type item struct {
+	r    rune
+	atom string
+}
 
-	flushPlain := func() {
-		if buf.Len() > 0 {
-			out.WriteString(html.EscapeString(buf.String()))
-			buf.Reset()
-		}
+func (it item) isAtom() bool {
+	return it.atom != ""
+}
+
+func (it item) html() string {
+	if it.isAtom() {
+		return it.atom
 	}
+	return html.EscapeString(string(it.r))
+}
 
-	for i := 0; i < len(s); {
-		var matched string
-		for tok := range Tokens {
-			if strings.HasPrefix(s[i:], tok) {
-				matched = tok
-				break
-			}
+func runeItems(s string) []item {
+	items := make([]item, 0, len(s))
+	for _, r := range s {
+		items = append(items, item{r: r})
+	}
+	return items
+}
+
+// canOpen reports whether the marker at i can open a span: it must not follow
+// a word character, and must be followed by something other than a space
+func canOpen(items []item, i int) bool {
+	if i > 0 && !items[i-1].isAtom() && isWord(items[i-1].r) {
+		return false
+	}
+	return i+1 < len(items) && (items[i+1].isAtom() || !unicode.IsSpace(items[i+1].r))
+}
+
+// canClose reports whether the marker at j can close a span, the mirror of canOpen
+func canClose(items []item, j int) bool {
+	if !items[j-1].isAtom() && unicode.IsSpace(items[j-1].r) {
+		return false
+	}
+	return j+1 == len(items) || items[j+1].isAtom() || !isWord(items[j+1].r)
+}
+
+// closers maps every position of items to the first marker at or after it
+// that can close a span, -1 when there is none
+func closers(items []item, marker rune) []int {
+	next := make([]int, len(items)+1)
+	next[len(items)] = -1
+	for j := len(items) - 1; j >= 0; j-- {
+		next[j] = next[j+1]
+		if j > 0 && !items[j].isAtom() && items[j].r == marker && canClose(items, j) {
+			next[j] = j
 		}
+	}
+	return next
+}
 
-		if matched != "" {
-			var prev, next rune
-			if i > 0 {
-				prev, _ = utf8.DecodeLastRuneInString(s[:i])
-			}
-			if i+1 < len(s) {
-				next, _ = utf8.DecodeRuneInString(s[i+1:])
-			}
-			if isWord(prev) && isWord(next) {
-				buf.WriteByte(s[i])
-				i++
+// renderStyled renders bold, italic and strikethrough spans. A span closes on
+// the first matching marker that can close it, its content is styled again
+// so that spans of different markers nest. The closers are looked up once
+// for the whole line, which keeps rendering linear.
+func renderStyled(items []item) string {
+	next := make(map[rune][]int, len(Tokens))
+	for marker := range Tokens {
+		next[marker] = closers(items, marker)
+	}
+	var out strings.Builder
+	renderSpan(&out, items, next, 0, len(items))
+	return out.String()
+}
+
+// renderSpan renders items[lo:hi], the spans it opens must close before hi
+func renderSpan(out *strings.Builder, items []item, next map[rune][]int, lo, hi int) {
+	for i := lo; i < hi; i++ {
+		it := items[i]
+		if tag, ok := Tokens[it.r]; ok && !it.isAtom() && canOpen(items, i) && i+2 <= len(items) {
+			if j := next[it.r][i+2]; j >= 0 && j < hi {
+				out.WriteString(openTag(tag))
+				renderSpan(out, items, next, i+1, j)
+				out.WriteString(closeTag(tag))
+				i = j
 				continue
 			}
+		}
+		out.WriteString(it.html())
+	}
+}
 
-			switch active {
-			case matched:
-				lastClose = buf.Len()
-				buf.WriteString(matched)
-				i += len(matched)
-				continue
+// codeSpans finds the code spans delimited by marker in a line, following
+// the same boundary rules as the style markers. The openers and closers are
+// indexed by byte offset so every span is found in constant time.
+type codeSpans struct {
+	marker string
+	// opener and closer hold the first marker at or after each offset that
+	// can open, respectively close, a span, -1 when there is none
+	opener, closer []int
+}
 
-			case "":
-				flushPlain()
-				active = matched
-				openPos = buf.Len()
-				lastClose = -1
-				buf.WriteString(matched)
+func newCodeSpans(s, marker string) *codeSpans {
+	cs := &codeSpans{
+		marker: marker,
+		opener: make([]int, len(s)+1),
+		closer: make([]int, len(s)+1),
+	}
+	cs.opener[len(s)], cs.closer[len(s)] = -1, -1
+	for i := len(s) - 1; i >= 0; i-- {
+		cs.opener[i], cs.closer[i] = cs.opener[i+1], cs.closer[i+1]
+		if !strings.HasPrefix(s[i:], marker) {
+			continue
+		}
+		prev, _ := utf8.DecodeLastRuneInString(s[:i])
+		rest := s[i+len(marker):]
+		first, _ := utf8.DecodeRuneInString(rest)
 
-			default:
-				buf.WriteString(matched)
-			}
+		// the content of a code span can't start with its marker
+		if (i == 0 || !isWord(prev)) && rest != "" && !unicode.IsSpace(first) &&
+			!(marker == codeMarker && strings.HasPrefix(rest, codeMarker)) {
+			cs.opener[i] = i
+		}
+		if i > 0 && !unicode.IsSpace(prev) && !isWord(first) {
+			cs.closer[i] = i
+		}
+	}
+	return cs
+}
 
-			i += len(matched)
-			continue
+// next returns the byte offsets of the opening and closing markers of the
+// first code span starting at or after from
+func (cs *codeSpans) next(from int) (int, int, bool) {
+	i := cs.opener[from]
+	if i < 0 {
+		return 0, 0, false
+	}
+	// spans aren't empty
+	if content := i + len(cs.marker) + 1; content < len(cs.closer) {
+		if j := cs.closer[content]; j >= 0 {
+			return i, j, true
 		}
+	}
+	return 0, 0, false
+}
 
-		buf.WriteByte(s[i])
-		i++
+func codeSpan(content string) string {
+	return `<span class="inline-code">` + html.EscapeString(content) + `</span>`
+}
+
+// lineItems splits a line into runes and atoms, rendering code spans and links
+func lineItems(s string) []item {
+	if !strings.Contains(s, codeMarker) {
+		return linkItems(s)
 	}
-	if active != "" &&
-		lastClose > openPos &&
-		strings.TrimSpace(
-			buf.String()[openPos+len(active):lastClose],
-		) != "" {
-		before := buf.String()[:openPos]
-		content := buf.String()[openPos+len(active) : lastClose]
-		after := buf.String()[lastClose+len(active):]
+	markers := []*codeSpans{newCodeSpans(s, blockMarker), newCodeSpans(s, codeMarker)}
 
-		out.WriteString(html.EscapeString(before))
-		out.WriteString(openTag(Tokens[active]))
-		out.WriteString(html.EscapeString(content))
-		out.WriteString(closeTag(Tokens[active]))
-		out.WriteString(html.EscapeString(after))
-	} else {
-		out.WriteString(html.EscapeString(buf.String()))
+	var items []item
+	for pos := 0; pos < len(s); {
+		start, end, marker := -1, -1, ""
+		for _, cs := range markers {
+			if i, j, ok := cs.next(pos); ok && (start < 0 || i < start) {
+				start, end, marker = i, j, cs.marker
+			}
+		}
+		if start < 0 {
+			items = append(items, linkItems(s[pos:])...)
+			break
+		}
+		items = append(items, linkItems(s[pos:start])...)
+		items = append(items, item{atom: codeSpan(s[start+len(marker) : end])})
+		pos = end + len(marker)
 	}
+	return items
+}
 
-	return out.String()
+// ParseInline renders the inline formatting of a single line. The output is
+// escaped HTML.
+func ParseInline(s string) string {
+	return renderStyled(lineItems(s))
 }
 
 func isUnorderedList(line string) (bool, string) {
@@ -126,27 +226,95 @@ func isUnorderedList(line string) (bool, string) {
 	return false, ""
 }
 
-// line parser (for quotes and lists[pending])
+var orderedListRegex = regexp.MustCompile(`^(\d{1,9})\. (\S.*)$`)
+
+// isOrderedList matches "1. item" lines, returning the number of the item
+func isOrderedList(line string) (bool, string, string) {
+	m := orderedListRegex.FindStringSubmatch(line)
+	if m == nil {
+		return false, "", ""
+	}
+	num := strings.TrimLeft(m[1], "0")
+	if num == "" {
+		num = "0"
+	}
+	return true, num, m[2]
+}
+
+// codeBlock matches a monospace block starting at lines[0]: the line starts
+// with ``` and a later line ends with ```. It returns the
+// content of the block and the number of lines it spans.
+func codeBlock(lines []string) (string, int, bool) {
+	first := strings.TrimRight(lines[0], "\r")
+	if !strings.HasPrefix(first, blockMarker) {
+		return "", 0, false
+	}
+	rest := first[len(blockMarker):]
+	if strings.Contains(rest, blockMarker) {
+		// a single line block is a code span
+		return "", 0, false
+	}
+
+	content := []string{rest}
+	for n, line := range lines[1:] {
+		line = strings.TrimRight(line, "\r")
+		if strings.HasSuffix(line, blockMarker) {
+			content = append(content, strings.TrimSuffix(line, blockMarker))
+			// the markers usually sit on their own lines
+			if content[0] == "" {
+				content = content[1:]
+			}
+			if len(content) > 0 && content[len(content)-1] == "" {
+				content = content[:len(content)-1]
+			}
+			if len(content) == 0 {
+				return "", 0, false
+			}
+			return strings.Join(content, "\n"), n + 2, true
+		}
+		content = append(content, line)
+	}
+	return "", 0, false
+}
+
+// MarkdownLinesToHTML renders a message in WhatsApp's markdown dialect:
+// ``` monospace blocks, "> " quotes, "- "/"* " and "1. " lists, and inline
+// formatting and links on every other line. The output is escaped HTML.
 func MarkdownLinesToHTML(s string) string {
 	lines := strings.Split(s, "\n")
 	var out strings.Builder
 
 	inQuote := false
 	inUL := false
+	inOL := false
 
 	closeAll := func() {
 		if inUL {
 			out.WriteString("</ul>")
 			inUL = false
 		}
+		if inOL {
+			out.WriteString("</ol>")
+			inOL = false
+		}
 		if inQuote {
 			out.WriteString("</blockquote>")
 			inQuote = false
 		}
 	}
 
-	for _, line := range lines {
-		line = strings.TrimRight(line, "\r")
+	for i := 0; i < len(lines); i++ {
+		// monospace block, its content is kept as is
+		if content, n, ok := codeBlock(lines[i:]); ok {
+			closeAll()
+			out.WriteString(`<pre class="code-block">`)
+			out.WriteString(html.EscapeString(content))
+			out.WriteString("</pre>")
+			i += n - 1
+			continue
+		}
+
+		line := strings.TrimRight(lines[i], "\r")
 		if strings.TrimSpace(line) == "" {
 			closeAll()
 			out.WriteString("<br>")
@@ -154,7 +322,9 @@ func MarkdownLinesToHTML(s string) string {
 		}
 		// blockquote
 		if strings.HasPrefix(line, "> ") {
-			if !inQuote {
+			if inQuote {
+				out.WriteString("<br>")
+			} else {
 				closeAll()
 				out.WriteString("<blockquote>")
 				inQuote = true
@@ -176,13 +346,28 @@ func MarkdownLinesToHTML(s string) string {
 			continue
 		}
 
+		// ordered list, numbered from its first item
+		if ok, num, content := isOrderedList(line); ok {
+			if !inOL {
+				closeAll()
+				if num == "1" {
+					out.WriteString("<ol>")
+				} else {
+					out.WriteString(`<ol start="` + num + `">`)
+				}
+				inOL = true
+			}
+			out.WriteString("<li>")
+			out.WriteString(ParseInline(content))
+			out.WriteString("</li>")
+			continue
+		}
+
 		// normal line
 		closeAll()
-		if strings.TrimSpace(line) != "" {
-			out.WriteString("<p>")
-			out.WriteString(ParseInline(line))
-			out.WriteString("</p>")
-		}
+		out.WriteString("<p>")
+		out.WriteString(ParseInline(line))
+		out.WriteString("</p>")
 	}
 
 	closeAll()
@@ -0,0 +1,108 @@
+package markdown
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func link(href, text string) string {
+	return `<a href="` + href + `" target="_blank" rel="noopener noreferrer">` + text + `</a>`
+}
+
+func TestMarkdownLinesToHTML(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		// inline styles
+		{"bold", "*bold*", "<p><b>bold</b></p>"},
+		{"italic", "_it_", "<p><i>it</i></p>"},
+		{"strike", "~s~", "<p><s>s</s></p>"},
+		{"inline code", "`code`", `<p><span class="inline-code">code</span></p>`},
+		{"inline monospace", "```code``` tail", `<p><span class="inline-code">code</span> tail</p>`},
+		{"several spans", "*a* and *b*", "<p><b>a</b> and <b>b</b></p>"},
+		{"unicode neighbours", "😀*emoji*😀", "<p>😀<b>emoji</b>😀</p>"},
+		{"empty span", "**", "<p>**</p>"},
+
+		// nesting
+		{"bold italic", "*_both_*", "<p><b><i>both</i></b></p>"},
+		{"italic bold", "_*both*_", "<p><i><b>both</b></i></p>"},
+		{"three levels", "x ~_*all*_~ y", "<p>x <s><i><b>all</b></i></s> y</p>"},
+		{"no styles in code", "`*not*`", `<p><span class="inline-code">*not*</span></p>`},
+		{"no styles in monospace", "```*mono*```", `<p><span class="inline-code">*mono*</span></p>`},
+		{"styled link", "*https://x.com*", "<p><b>" + link("https://x.com", "https://x.com") + "</b></p>"},
+
+		// boundaries
+		{"inside a word", "a*b*c", "<p>a*b*c</p>"},
+		{"snake case", "snake_case_name", "<p>snake_case_name</p>"},
+		{"space after opening", "*not bold *", "<p>*not bold *</p>"},
+		{"space before closing", "a_b_ c", "<p>a_b_ c</p>"},
+		{"unclosed", "_a_b", "<p>_a_b</p>"},
+		{"crossed spans", "*a _b* c_", "<p><b>a _b</b> c_</p>"},
+		{"first closer", "`a `b` c", "<p><span class=\"inline-code\">a `b</span> c</p>"},
+
+		// escaping
+		{"html", "<script>*x*</script>", "<p>&lt;script&gt;<b>x</b>&lt;/script&gt;</p>"},
+		{"html in code", "`<b>`", `<p><span class="inline-code">&lt;b&gt;</span></p>`},
+		{"html in link", "https://x.com/?a=1&b=<2>", "<p>" + link("https://x.com/?a=1&amp;b=", "https://x.com/?a=1&amp;b=") + "&lt;2&gt;</p>"},
+		{"quotes in link", `https://x.com/"onclick=`, "<p>" + link("https://x.com/", "https://x.com/") + "&#34;onclick=</p>"},
+
+		// links
+		{"url", "see https://example.com/a_b_c.", "<p>see " + link("https://example.com/a_b_c", "https://example.com/a_b_c") + ".</p>"},
+		{"url in brackets", "(https://en.wikipedia.org/wiki/Go_(language))", "<p>(" + link("https://en.wikipedia.org/wiki/Go_(language)", "https://en.wikipedia.org/wiki/Go_(language)") + ")</p>"},
+		{"www", "www.example.com", "<p>" + link("https://www.example.com", "www.example.com") + "</p>"},
+		{"www with url", "www.example.com/?r=http://x", "<p>" + link("https://www.example.com/?r=http://x", "www.example.com/?r=http://x") + "</p>"},
+		{"uppercase scheme", "HTTPS://example.com", "<p>" + link("HTTPS://example.com", "HTTPS://example.com") + "</p>"},
+		{"email", "mail me@example.com", "<p>mail " + link("mailto:me@example.com", "me@example.com") + "</p>"},
+		{"phone", "call +91 98765 43210 now", "<p>call " + link("tel:+919876543210", "+91 98765 43210") + " now</p>"},
+		{"short number", "+123", "<p>+123</p>"},
+		{"mention", "@919876543210 hi", "<p>@919876543210 hi</p>"},
+
+		// blocks
+		{"unordered list", "- a\n- b\n\ntext", "<ul><li>a</li><li>b</li></ul><br><p>text</p>"},
+		{"star list", "* not bold*", "<ul><li>not bold*</li></ul>"},
+		{"ordered list", "1. one\n2. two", "<ol><li>one</li><li>two</li></ol>"},
+		{"ordered list start", "3. three\n4. four", `<ol start="3"><li>three</li><li>four</li></ol>`},
+		{"decimal", "2.5 is not a list", "<p>2.5 is not a list</p>"},
+		{"list switch", "- a\n1. b", "<ul><li>a</li></ul><ol><li>b</li></ol>"},
+		{"quote", "> q1\n> q2\nafter", "<blockquote>q1<br>q2</blockquote><p>after</p>"},
+		{"styled quote", "> *q*", "<blockquote><b>q</b></blockquote>"},
+		{"code block", "```\nfunc main() {\n\t*x* <b>\n}\n```", "<pre class=\"code-block\">func main() {\n\t*x* &lt;b&gt;\n}</pre>"},
+		{"code block inline markers", "```a\nb```", "<pre class=\"code-block\">a\nb</pre>"},
+		{"unterminated code block", "```\nunterminated", "<p>```</p><p>unterminated</p>"},
+		{"crlf", "*a*\r\n_b_", "<p><b>a</b></p><p><i>b</i></p>"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := MarkdownLinesToHTML(tt.in); got != tt.want {
+				t.Errorf("MarkdownLinesToHTML(%q)\n got: %q\nwant: %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMarkdownLinesToHTMLAdversarial(t *testing.T) {
+	// every marker opens a span that never closes
+	for _, unit := range []string{"*a ", "_a ~a ", "`a ", "*`a "} {
+		in := strings.Repeat(unit, 100_000/len(unit))
+		start := time.Now()
+		got := MarkdownLinesToHTML(in)
+		if elapsed := time.Since(start); elapsed > 2*time.Second {
+			t.Errorf("rendering %q repeats took %v", unit, elapsed)
+		}
+		if want := "<p>" + in + "</p>"; got != want {
+			t.Errorf("rendering %q repeats styled the text", unit)
+		}
+	}
+}
+
+func TestExtractLinks(t *testing.T) {
+	got := ExtractLinks("see www.example.com/?r=http://x, HTTP://a.b and me@example.com")
+	want := []string{"https://www.example.com/?r=http://x", "HTTP://a.b"}
+	if strings.Join(got, " ") != strings.Join(want, " ") {
+		t.Errorf("ExtractLinks() = %q, want %q", got, want)
+	}
+}
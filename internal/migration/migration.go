@@ -0,0 +1,76 @@
+package migration
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+
+	"github.com/lugvitc/whats4linux/internal/query"
+)
+
+// Migration upgrades a database schema by exactly one version.
+// Migrations are append-only: never edit or reorder a released one.
+type Migration func(tx *sql.Tx) error
+
+// Exec returns a migration that runs the given statements
+func Exec(stmts ...string) Migration {
+	return func(tx *sql.Tx) error {
+		for _, stmt := range stmts {
+			if _, err := tx.Exec(stmt); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// AddColumn returns a migration that adds a column to a table, unless
+// it's already there (databases created before versioning may have it)
+func AddColumn(table, column, definition string) Migration {
+	return func(tx *sql.Tx) error {
+		var count int
+		err := tx.QueryRow(query.SelectColumnExists, table, column).Scan(&count)
+		if err != nil || count > 0 {
+			return err
+		}
+		_, err = tx.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, column, definition))
+		return err
+	}
+}
+
+// Apply brings the schema of db up to date. The current version is kept
+// in PRAGMA user_version and equals the number of applied migrations.
+// Every migration runs in its own transaction along with the version bump.
+// A database whose version is newer than len(migrations) is refused, it
+// was written by a newer build.
+func Apply(db *sql.DB, name string, migrations []Migration) error {
+	var version int
+	if err := db.QueryRow(query.SelectUserVersion).Scan(&version); err != nil {
+		return fmt.Errorf("failed to read %s schema version: %w", name, err)
+	}
+
+	latest := len(migrations)
+	if version > latest {
+		return fmt.Errorf("%s schema version %d is newer than the supported version %d, please update whats4linux", name, version, latest)
+	}
+
+	for v := version; v < latest; v++ {
+		tx, err := db.Begin()
+		if err != nil {
+			return fmt.Errorf("failed to begin %s migration %d: %w", name, v+1, err)
+		}
+		if err := migrations[v](tx); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("%s migration %d failed: %w", name, v+1, err)
+		}
+		if _, err := tx.Exec(fmt.Sprintf(query.SetUserVersion, v+1)); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("failed to set %s schema version %d: %w", name, v+1, err)
+		}
+		if err := tx.Commit(); err != nil {
+			return fmt.Errorf("failed to commit %s migration %d: %w", name, v+1, err)
+		}
+		log.Printf("Migrated %s to schema version %d\n", name, v+1)
+	}
+	return nil
+}
@@ -0,0 +1,27 @@
+package misc
+
+import (
+	"github.com/godbus/dbus/v5"
+)
+
+// NetworkManager's NMMetered values meaning the connection is metered
+const (
+	nmMeteredYes      = 1
+	nmMeteredGuessYes = 3
+)
+
+// IsMetered reports whether NetworkManager considers the primary connection
+// metered. It reports false when NetworkManager isn't reachable.
+func IsMetered() bool {
+	conn, err := dbus.SystemBus()
+	if err != nil {
+		return false
+	}
+	v, err := conn.Object("org.freedesktop.NetworkManager", "/org/freedesktop/NetworkManager").
+		GetProperty("org.freedesktop.NetworkManager.Metered")
+	if err != nil {
+		return false
+	}
+	metered, ok := v.Value().(uint32)
+	return ok && (metered == nmMeteredYes || metered == nmMeteredGuessYes)
+}
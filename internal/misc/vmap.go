@@ -30,6 +30,18 @@ func (vm *VMap[kT, vT]) Set(key kT, val vT) {
 	vm.kv[key] = val
 }
 
+// SetIfAbsent stores a value for the given key unless the key is already
+// set, reporting whether it stored it.
+func (vm *VMap[kT, vT]) SetIfAbsent(key kT, val vT) bool {
+	vm.mu.Lock()
+	defer vm.mu.Unlock()
+	if _, ok := vm.kv[key]; ok {
+		return false
+	}
+	vm.kv[key] = val
+	return true
+}
+
 // GetUnsafe retrieves a value without lock protection. Use only when already holding a lock.
 func (vm *VMap[kT, vT]) GetUnsafe(key kT) (val vT, ok bool) {
 	val, ok = vm.kv[key]
@@ -50,6 +62,13 @@ func (vm *VMap[kT, vT]) Delete(key kT) {
 	delete(vm.kv, key)
 }
 
+// Clear removes every key with write lock protection.
+func (vm *VMap[kT, vT]) Clear() {
+	vm.mu.Lock()
+	defer vm.mu.Unlock()
+	clear(vm.kv)
+}
+
 // GetMap returns the internal map with read lock protection.
 func (kv *VMap[kT, vT]) GetMapWithMutex() (map[kT]vT, *sync.RWMutex) {
 	return kv.kv, &kv.mu
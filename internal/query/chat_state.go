@@ -0,0 +1,44 @@
+package query
+
+const (
+	// Per chat state synced through WhatsApp app state. pinned_at orders the
+	// pinned chats (0 when not pinned), muted_until is a unix timestamp, -1
+	// for chats muted forever and 0 for chats that aren't muted.
+	CreateChatStatesTable = `
+	CREATE TABLE IF NOT EXISTS whats4linux_chat_states (
+		jid TEXT PRIMARY KEY,
+		archived BOOLEAN DEFAULT FALSE,
+		pinned_at INTEGER DEFAULT 0,
+		muted_until INTEGER DEFAULT 0
+	);
+	`
+
+	UpsertChatArchived = `
+	INSERT INTO whats4linux_chat_states (jid, archived)
+	VALUES (?, ?)
+	ON CONFLICT (jid) DO UPDATE SET archived = excluded.archived;
+	`
+
+	UpsertChatPinned = `
+	INSERT INTO whats4linux_chat_states (jid, pinned_at)
+	VALUES (?, ?)
+	ON CONFLICT (jid) DO UPDATE SET pinned_at = excluded.pinned_at;
+	`
+
+	UpsertChatMuted = `
+	INSERT INTO whats4linux_chat_states (jid, muted_until)
+	VALUES (?, ?)
+	ON CONFLICT (jid) DO UPDATE SET muted_until = excluded.muted_until;
+	`
+
+	SelectChatState = `
+	SELECT jid, archived, pinned_at, muted_until
+	FROM whats4linux_chat_states
+	WHERE jid = ?;
+	`
+
+	SelectAllChatStates = `
+	SELECT jid, archived, pinned_at, muted_until
+	FROM whats4linux_chat_states;
+	`
+)
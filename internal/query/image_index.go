@@ -1,7 +1,8 @@
 package query
 
 const (
-	// Image cache queries
+	// Media cache queries (idxdb). The table keeps its original name, it
+	// indexed images only before the cache was generalized.
 	CreateImageIndexTable = `
 	CREATE TABLE IF NOT EXISTS image_index (
 		message_id TEXT PRIMARY KEY,
@@ -14,10 +15,22 @@ const (
 	CREATE INDEX IF NOT EXISTS idx_sha ON image_index (sha256);
 	`
 
+	CreateImageIndexLastAccessIndex = `
+	CREATE INDEX IF NOT EXISTS idx_last_access ON image_index (last_access);
+	`
+
+	// SetImageIndexLastAccess initializes last_access of the entries
+	// created before it was tracked
+	SetImageIndexLastAccess = `
+	UPDATE image_index
+	SET last_access = created_at
+	WHERE last_access IS NULL
+	`
+
 	SaveImageIndex = `
 	INSERT OR REPLACE INTO image_index
-	(message_id, sha256, mime, width, height, created_at)
-	VALUES (?, ?, ?, ?, ?, ?)
+	(message_id, sha256, mime, media_type, width, height, size, created_at, last_access)
+	VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
 	`
 
 	DeleteImageIndex = `
@@ -26,7 +39,7 @@ const (
 	`
 
 	GetImageByID = `
-	SELECT message_id, sha256, mime, width, height, created_at
+	SELECT message_id, sha256, mime, media_type, width, height, COALESCE(size, 0), created_at
 	FROM image_index
 	WHERE message_id = ?
 	`
@@ -35,8 +48,82 @@ const (
 	// Use it with a dynamically built placeholder list, e.g.
 	// q := query.GetImagesByIDsPrefix + strings.Join(placeholders, ",") + ")"
 	GetImagesByIDsPrefix = `
-	SELECT message_id, sha256, mime, width, height, created_at
+	SELECT message_id, sha256, mime, media_type, width, height, COALESCE(size, 0), created_at
 	FROM image_index
 	WHERE message_id IN (
 	`
+
+	TouchImageIndex = `
+	UPDATE image_index
+	SET last_access = ?
+	WHERE message_id = ?
+	`
+
+	// SelectCacheUsage returns the number and total size of the cached files,
+	// entries sharing a file are counted once
+	SelectCacheUsage = `
+	SELECT COUNT(*), COALESCE(SUM(size), 0)
+	FROM (
+		SELECT MAX(COALESCE(size, 0)) AS size
+		FROM image_index
+		GROUP BY sha256
+	)
+	`
+
+	// SelectLeastRecentlyUsedFiles returns the cached files ordered by the
+	// last time any entry pointing to them was read
+	SelectLeastRecentlyUsedFiles = `
+	SELECT sha256, MAX(mime), MAX(COALESCE(size, 0))
+	FROM image_index
+	GROUP BY sha256
+	ORDER BY MAX(last_access) ASC
+	LIMIT ?
+	`
+
+	SelectIndexedFiles = `
+	SELECT sha256, MAX(mime), MAX(size) IS NULL
+	FROM image_index
+	GROUP BY sha256
+	`
+
+	UpdateImageIndexSize = `
+	UPDATE image_index
+	SET size = ?
+	WHERE sha256 = ?
+	`
+
+	DeleteImageIndexBySHA = `
+	DELETE FROM image_index
+	WHERE sha256 = ?
+	`
+
+	DeleteAllImageIndex = `
+	DELETE FROM image_index
+	`
+
+	// download_queue holds the media waiting to be auto-downloaded, so that
+	// the downloads not done yet survive restarts
+	CreateDownloadQueueTable = `
+	CREATE TABLE IF NOT EXISTS download_queue (
+		message_id TEXT PRIMARY KEY,
+		queued_at  INTEGER NOT NULL
+	);
+	`
+
+	EnqueueDownload = `
+	INSERT OR IGNORE INTO download_queue (message_id, queued_at)
+	VALUES (?, ?)
+	`
+
+	SelectQueuedDownloads = `
+	SELECT message_id
+	FROM download_queue
+	ORDER BY queued_at ASC
+	LIMIT ?
+	`
+
+	DeleteQueuedDownload = `
+	DELETE FROM download_queue
+	WHERE message_id = ?
+	`
 )
@@ -0,0 +1,47 @@
+package query
+
+const (
+	// message_links indexes the web links sent in messages, so that the links
+	// of a chat can be listed without going through all of its text
+	CreateMessageLinksTable = `
+	CREATE TABLE IF NOT EXISTS message_links (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		message_id TEXT NOT NULL,
+		chat_jid TEXT NOT NULL,
+		url TEXT NOT NULL,
+		timestamp INTEGER NOT NULL
+	);
+	CREATE INDEX IF NOT EXISTS idx_message_links_message_id ON message_links(message_id);
+	CREATE INDEX IF NOT EXISTS idx_message_links_chat ON message_links(chat_jid, timestamp);
+	`
+
+	InsertMessageLink = `
+	INSERT INTO message_links (message_id, chat_jid, url, timestamp)
+	SELECT message_id, chat_jid, ?, timestamp FROM messages WHERE message_id = ?
+	`
+
+	DeleteMessageLinks = `
+	DELETE FROM message_links
+	WHERE message_id = ?
+	`
+
+	// SelectMessagesWithLinks returns the messages that may contain links,
+	// used to backfill message_links
+	SelectMessagesWithLinks = `
+	SELECT message_id, text
+	FROM messages
+	WHERE text LIKE '%http%' OR text LIKE '%www.%'
+	`
+
+	// SelectChatLinksPage returns the links of a chat, newest first, before
+	// the cursor (?2, ?3)
+	SelectChatLinksPage = `
+	SELECT l.id, l.message_id, m.sender_jid, l.timestamp, l.url, m.text
+	FROM message_links AS l
+	JOIN messages AS m ON m.message_id = l.message_id
+	WHERE l.chat_jid = ?1 AND m.deleted = FALSE
+	AND (l.timestamp < ?2 OR (l.timestamp = ?2 AND l.id < ?3))
+	ORDER BY l.timestamp DESC, l.id DESC
+	LIMIT ?4
+	`
+)
@@ -0,0 +1,66 @@
+package query
+
+const (
+	// message_edits keeps every prior version of an edited message. It has
+	// no foreign key on messages, re-inserting a message upserts its row in
+	// place (see InsertMessage) and deleting one removes its history with
+	// DeleteMessageEditsByMessageID.
+	CreateMessageEditsTable = `
+	CREATE TABLE IF NOT EXISTS message_edits (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		message_id TEXT NOT NULL,
+		text TEXT,
+		version_timestamp INTEGER NOT NULL,
+		edited_at INTEGER NOT NULL,
+		editor_jid TEXT NOT NULL
+	);
+	CREATE INDEX IF NOT EXISTS idx_message_edits_message_id ON message_edits(message_id);
+	`
+
+	// InsertMessageEdit snapshots the current text and mentions of a message
+	// before they get overwritten. The version timestamp is the time of the previous edit, or
+	// the message timestamp if it was never edited. Nothing is saved when the
+	// text doesn't change.
+	InsertMessageEdit = `
+	INSERT INTO message_edits (message_id, text, mentions, version_timestamp, edited_at, editor_jid)
+	SELECT m.message_id, m.text, m.mentions,
+		COALESCE((SELECT MAX(e.edited_at) FROM message_edits AS e WHERE e.message_id = m.message_id), m.timestamp),
+		?, ?
+	FROM messages AS m
+	WHERE m.message_id = ? AND COALESCE(m.text, '') != ?
+	`
+
+	// SetMessageEditMentions fills the mentions of the versions saved before
+	// they were snapshotted with the current ones of their message, the best
+	// guess left
+	SetMessageEditMentions = `
+	UPDATE message_edits
+	SET mentions = (SELECT m.mentions FROM messages AS m WHERE m.message_id = message_edits.message_id)
+	WHERE mentions IS NULL
+	`
+
+	DeleteMessageEditsByMessageID = `
+	DELETE FROM message_edits
+	WHERE message_id = ?
+	`
+
+	SelectMessageEditsByChatAndID = `
+	SELECT e.id, e.message_id, e.text, e.mentions, e.version_timestamp, e.edited_at, e.editor_jid
+	FROM message_edits AS e
+	JOIN messages AS m ON m.message_id = e.message_id
+	WHERE m.chat_jid = ? AND e.message_id = ?
+	ORDER BY e.id ASC
+	`
+
+	SelectRenderedMessageEdits = `
+	SELECT id, text
+	FROM message_edits
+	WHERE text LIKE '<%'
+	`
+
+	UpdateMessageEditText = `
+	UPDATE message_edits
+	SET text = ?
+	WHERE id = ?
+	`
+)
@@ -19,16 +19,53 @@ const (
 
 	InsertMessageMedia = `
 	INSERT OR REPLACE INTO message_media
-	(message_id, type, url, mimetype, direct_path, media_key, file_sha256, file_enc_sha256, width, height, file_name)
-	VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?);
+	(message_id, type, url, mimetype, direct_path, media_key, file_sha256, file_enc_sha256, width, height, file_name, seconds, waveform, ptt)
+	VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?);
+	`
+
+	InsertMessageMediaIfMissing = `
+	INSERT OR IGNORE INTO message_media
+	(message_id, type, url, mimetype, direct_path, media_key, file_sha256, file_enc_sha256, width, height, file_name, seconds, waveform, ptt)
+	VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?);
 	`
 
 	UpdateMessageMediaByMessageID = `
 	UPDATE message_media
-	SET type = ?, url = ?, mimetype = ?, direct_path = ?, media_key = ?, file_sha256 = ?, file_enc_sha256 = ?, width = ?, height = ?, file_name = ?
+	SET type = ?, url = ?, mimetype = ?, direct_path = ?, media_key = ?, file_sha256 = ?, file_enc_sha256 = ?, width = ?, height = ?, file_name = ?, seconds = ?, waveform = ?, ptt = ?
+	WHERE message_id = ?;
+	`
+
+	// UpdateMessageMediaDirectPath sets the path of media the phone uploaded
+	// again, the old URL is expired
+	UpdateMessageMediaDirectPath = `
+	UPDATE message_media
+	SET direct_path = ?, url = ''
 	WHERE message_id = ?;
 	`
 
+	DeleteMessageMediaByMessageID = `
+	DELETE FROM message_media
+	WHERE message_id = ?;
+	`
+
+	SelectAudioInfoByMessageID = `
+	SELECT seconds, waveform, ptt
+	FROM message_media
+	WHERE message_id = ?;
+	`
+
+	// SelectChatMediaPage returns the media of one or two types (?2, ?3) of a
+	// chat, newest first, before the cursor (?4, ?5)
+	SelectChatMediaPage = `
+	SELECT m.message_id, m.sender_jid, m.timestamp, m.text, mm.type, mm.mimetype, mm.file_name, mm.width, mm.height, mm.seconds
+	FROM messages AS m
+	JOIN message_media AS mm ON mm.message_id = m.message_id
+	WHERE m.chat_jid = ?1 AND m.deleted = FALSE AND mm.type IN (?2, ?3)
+	AND (m.timestamp < ?4 OR (m.timestamp = ?4 AND m.message_id < ?5))
+	ORDER BY m.timestamp DESC, m.message_id DESC
+	LIMIT ?6
+	`
+
 	SelectMessageMediaByMessageID = `
 	SELECT type, url, mimetype, direct_path, media_key, file_sha256, file_enc_sha256, width, height, file_name
 	FROM message_media
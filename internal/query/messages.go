@@ -21,26 +21,69 @@ const (
 	CREATE INDEX IF NOT EXISTS idx_messages_timestamp ON messages(timestamp DESC);
 	`
 
+	// InsertMessage keeps the unread flag of messages delivered again, they
+	// were possibly read already
 	InsertMessage = `
-	INSERT OR REPLACE INTO messages 
-	(message_id, chat_jid, sender_jid, timestamp, is_from_me, text, has_media, reply_to_message_id, edited, forwarded)
-	VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	INSERT INTO messages
+	(message_id, chat_jid, sender_jid, timestamp, is_from_me, text, mentions, has_media, reply_to_message_id, edited, forwarded, status, unread)
+	VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	ON CONFLICT (message_id) DO UPDATE SET
+		chat_jid = excluded.chat_jid,
+		sender_jid = excluded.sender_jid,
+		timestamp = excluded.timestamp,
+		is_from_me = excluded.is_from_me,
+		text = excluded.text,
+		mentions = excluded.mentions,
+		has_media = excluded.has_media,
+		reply_to_message_id = excluded.reply_to_message_id,
+		edited = excluded.edited,
+		forwarded = excluded.forwarded,
+		status = excluded.status
+	`
+
+	// InsertMessageIfMissing is used for history sync, messages that are
+	// already stored (possibly edited or revoked since) are left untouched
+	InsertMessageIfMissing = `
+	INSERT OR IGNORE INTO messages
+	(message_id, chat_jid, sender_jid, timestamp, is_from_me, text, mentions, has_media, reply_to_message_id, edited, forwarded, status, unread)
+	VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
 	`
 
 	UpdateMessage = `
 	UPDATE messages
-	SET text = ?, edited = TRUE
+	SET text = ?, mentions = ?, edited = TRUE
+	WHERE message_id = ?
+	`
+
+	// MarkMessageRevoked flags a message as deleted for everyone but keeps its content
+	MarkMessageRevoked = `
+	UPDATE messages
+	SET deleted = TRUE
+	WHERE message_id = ?
+	`
+
+	// ClearRevokedMessage flags a message as deleted for everyone and drops its content
+	ClearRevokedMessage = `
+	UPDATE messages
+	SET deleted = TRUE, text = NULL, mentions = NULL, has_media = FALSE
+	WHERE message_id = ?
+	`
+
+	// DeleteMessage removes a message, its reactions are removed by the
+	// foreign key
+	DeleteMessage = `
+	DELETE FROM messages
 	WHERE message_id = ?
 	`
 
 	SelectMessageByID = `
-	SELECT chat_jid, sender_jid, timestamp, is_from_me, text, has_media, reply_to_message_id, edited, forwarded
+	SELECT chat_jid, sender_jid, timestamp, is_from_me, text, has_media, reply_to_message_id, edited, forwarded, deleted
 	FROM messages
 	WHERE message_id = ?
 	`
 
 	SelectDecodedMessageByChatAndID = `
-	SELECT m.sender_jid, m.timestamp, m.is_from_me, m.text, m.reply_to_message_id, m.edited, m.forwarded, mm.type, mm.file_name
+	SELECT m.sender_jid, m.timestamp, m.is_from_me, m.text, m.mentions, m.reply_to_message_id, m.edited, m.forwarded, m.deleted, m.status, mm.type, mm.file_name
 	FROM messages AS m
 	LEFT JOIN message_media AS mm ON mm.message_id = m.message_id
 	WHERE m.chat_jid = ? AND m.message_id = ?
@@ -61,9 +104,9 @@ const (
 
 	// Messages.db paged queries (for frontend)
 	SelectMessagesByChatBeforeTimestamp = `
-	SELECT m.message_id, m.chat_jid, m.sender_jid, m.timestamp, m.is_from_me, m.text, m.reply_to_message_id, m.edited, m.forwarded, mm.type, mm.file_name
+	SELECT m.message_id, m.chat_jid, m.sender_jid, m.timestamp, m.is_from_me, m.text, m.mentions, m.reply_to_message_id, m.edited, m.forwarded, m.deleted, m.status, mm.type, mm.file_name
 	FROM (
-		SELECT message_id, chat_jid, sender_jid, timestamp, is_from_me, text, reply_to_message_id, edited, forwarded
+		SELECT message_id, chat_jid, sender_jid, timestamp, is_from_me, text, mentions, reply_to_message_id, edited, forwarded, deleted, status
 		FROM messages
 		WHERE chat_jid = ? AND timestamp < ?
 		ORDER BY timestamp DESC
@@ -74,9 +117,9 @@ const (
 	`
 
 	SelectLatestMessagesByChat = `
-	SELECT m.message_id, m.chat_jid, m.sender_jid, m.timestamp, m.is_from_me, m.text, m.reply_to_message_id, m.edited, m.forwarded, mm.type, mm.file_name
+	SELECT m.message_id, m.chat_jid, m.sender_jid, m.timestamp, m.is_from_me, m.text, m.mentions, m.reply_to_message_id, m.edited, m.forwarded, m.deleted, m.status, mm.type, mm.file_name
 	FROM (
-		SELECT message_id, chat_jid, sender_jid, timestamp, is_from_me, text, reply_to_message_id, edited, forwarded
+		SELECT message_id, chat_jid, sender_jid, timestamp, is_from_me, text, mentions, reply_to_message_id, edited, forwarded, deleted, status
 		FROM messages
 		WHERE chat_jid = ?
 		ORDER BY timestamp DESC
@@ -87,7 +130,7 @@ const (
 	`
 
 	SelectMessageByChatAndID = `
-	SELECT sender_jid, timestamp, is_from_me, text, has_media, reply_to_message_id, edited, forwarded
+	SELECT sender_jid, timestamp, is_from_me, text, has_media, reply_to_message_id, edited, forwarded, deleted
 	FROM messages
 	WHERE chat_jid = ? AND message_id = ?
 	LIMIT 1
@@ -95,10 +138,10 @@ const (
 
 	// Chat list from messages.db
 	SelectDecodedChatList = `
-	SELECT m.message_id, m.chat_jid, m.sender_jid, m.timestamp, m.is_from_me, m.text, m.reply_to_message_id, m.edited, m.forwarded, mm.type, mm.file_name
+	SELECT m.message_id, m.chat_jid, m.sender_jid, m.timestamp, m.is_from_me, m.text, m.mentions, m.reply_to_message_id, m.edited, m.forwarded, m.deleted, m.status, mm.type, mm.file_name
 	FROM (
 		SELECT 
-			message_id, chat_jid, sender_jid, timestamp, is_from_me, text, reply_to_message_id, edited, forwarded,
+			message_id, chat_jid, sender_jid, timestamp, is_from_me, text, mentions, reply_to_message_id, edited, forwarded, deleted, status,
 			ROW_NUMBER() OVER (
 				PARTITION BY chat_jid
 				ORDER BY timestamp DESC
@@ -110,6 +153,20 @@ const (
 	ORDER BY m.timestamp DESC;
 	`
 
+	// SelectRenderedMessages returns the messages whose text was stored as
+	// rendered HTML, every rendered text starts with a tag
+	SelectRenderedMessages = `
+	SELECT rowid, text
+	FROM messages
+	WHERE text LIKE '<%'
+	`
+
+	UpdateMessageTextByRowID = `
+	UPDATE messages
+	SET text = ?
+	WHERE rowid = ?
+	`
+
 	UpdateMessagesChat = `
 	UPDATE messages
 	SET chat_jid = ?
@@ -0,0 +1,13 @@
+package query
+
+const (
+	// Schema version bookkeeping, see internal/migration
+	SelectUserVersion = `PRAGMA user_version;`
+
+	// SetUserVersion is formatted with the version, PRAGMA doesn't take bound parameters
+	SetUserVersion = `PRAGMA user_version = %d;`
+
+	SelectColumnExists = `
+	SELECT COUNT(*) FROM pragma_table_info(?) WHERE name = ?
+	`
+)
@@ -18,6 +18,14 @@ const (
 	VALUES (?, ?, ?)
 	`
 
+	// InsertReactionIfMessageExists skips reactions to messages that
+	// aren't stored instead of failing on the foreign key
+	InsertReactionIfMessageExists = `
+	INSERT INTO reactions (message_id, sender_id, emoji)
+	SELECT ?1, ?2, ?3
+	WHERE EXISTS (SELECT 1 FROM messages WHERE message_id = ?1)
+	`
+
 	DeleteReaction = `
 	DELETE FROM reactions
 	WHERE message_id = ? AND sender_id = ? AND emoji = ?
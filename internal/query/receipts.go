@@ -0,0 +1,62 @@
+package query
+
+const (
+	// Per recipient delivery state of our own messages. There's no foreign
+	// key on messages, receipts may arrive for messages we never stored.
+	CreateMessageReceiptsTable = `
+	CREATE TABLE IF NOT EXISTS message_receipts (
+		message_id TEXT NOT NULL,
+		recipient_jid TEXT NOT NULL,
+		delivered_at INTEGER,
+		read_at INTEGER,
+		played_at INTEGER,
+		PRIMARY KEY (message_id, recipient_jid)
+	);
+	`
+
+	// UpsertMessageReceipt keeps the first timestamp of every state
+	UpsertMessageReceipt = `
+	INSERT INTO message_receipts (message_id, recipient_jid, delivered_at, read_at, played_at)
+	VALUES (?, ?, ?, ?, ?)
+	ON CONFLICT (message_id, recipient_jid) DO UPDATE SET
+		delivered_at = COALESCE(delivered_at, excluded.delivered_at),
+		read_at = COALESCE(read_at, excluded.read_at),
+		played_at = COALESCE(played_at, excluded.played_at)
+	`
+
+	// UpdateMessageStatusFromReceipts raises the aggregate status of one of our
+	// messages once enough recipients (?2, 1 outside of groups) reached a state.
+	// Status values match store.MessageStatus.
+	UpdateMessageStatusFromReceipts = `
+	UPDATE messages
+	SET status = MAX(status, CASE
+		WHEN (SELECT COUNT(*) FROM message_receipts WHERE message_id = ?1 AND played_at IS NOT NULL) >= ?2 THEN 4
+		WHEN (SELECT COUNT(*) FROM message_receipts WHERE message_id = ?1 AND read_at IS NOT NULL) >= ?2 THEN 3
+		WHEN (SELECT COUNT(*) FROM message_receipts WHERE message_id = ?1 AND delivered_at IS NOT NULL) >= ?2 THEN 2
+		ELSE 1
+	END)
+	WHERE message_id = ?1 AND is_from_me = TRUE
+	RETURNING status
+	`
+
+	DeleteMessageReceiptsByMessageID = `
+	DELETE FROM message_receipts
+	WHERE message_id = ?
+	`
+
+	SelectMessageReceipts = `
+	SELECT r.recipient_jid, r.delivered_at, r.read_at, r.played_at
+	FROM message_receipts AS r
+	JOIN messages AS m ON m.message_id = r.message_id
+	WHERE m.chat_jid = ? AND r.message_id = ?
+	ORDER BY r.delivered_at ASC
+	`
+
+	// MarkOwnMessagesSent gives messages stored before receipts were tracked
+	// the sent status
+	MarkOwnMessagesSent = `
+	UPDATE messages
+	SET status = 1
+	WHERE is_from_me = TRUE
+	`
+)
@@ -0,0 +1,57 @@
+package query
+
+const (
+	// Full-text search index over messages.text (messages.db).
+	// Rows are keyed by the rowid of the corresponding messages row and
+	// hold the plain-text (HTML stripped) form of the message.
+	CreateMessagesFTSTable = `
+	CREATE VIRTUAL TABLE IF NOT EXISTS messages_fts USING fts5(
+		text,
+		tokenize = 'unicode61 remove_diacritics 2'
+	);
+	`
+
+	DeleteMessageFTS = `
+	DELETE FROM messages_fts
+	WHERE rowid = (SELECT rowid FROM messages WHERE message_id = ?)
+	`
+
+	InsertMessageFTS = `
+	INSERT INTO messages_fts (rowid, text)
+	SELECT rowid, ? FROM messages WHERE message_id = ?
+	`
+
+	InsertMessageFTSByRowID = `
+	INSERT INTO messages_fts (rowid, text)
+	VALUES (?, ?)
+	`
+
+	// SelectMessagesMissingFTS returns the messages that have text but no
+	// search index entry yet, used to backfill messages_fts.
+	SelectMessagesMissingFTS = `
+	SELECT rowid, text
+	FROM messages
+	WHERE text IS NOT NULL AND text != ''
+	AND rowid NOT IN (SELECT rowid FROM messages_fts)
+	`
+
+	// SearchMessages ranks matches by bm25. Every filter is optional and is
+	// disabled by passing its zero value (empty string, 0, or -1 for the
+	// media type).
+	SearchMessages = `
+	SELECT m.message_id, m.chat_jid, m.sender_jid, m.timestamp, m.is_from_me, m.text, m.mentions, m.reply_to_message_id, m.edited, m.forwarded, m.deleted, m.status, mm.type, mm.file_name,
+		snippet(messages_fts, 0, char(2), char(3), '…', 16) AS snippet,
+		bm25(messages_fts) AS rank
+	FROM messages_fts
+	JOIN messages AS m ON m.rowid = messages_fts.rowid
+	LEFT JOIN message_media AS mm ON mm.message_id = m.message_id
+	WHERE messages_fts MATCH ?1
+	AND (?2 = '' OR m.chat_jid = ?2)
+	AND (?3 = '' OR m.sender_jid = ?3)
+	AND (?4 = 0 OR m.timestamp >= ?4)
+	AND (?5 = 0 OR m.timestamp <= ?5)
+	AND (?6 < 0 OR COALESCE(mm.type, 0) = ?6)
+	ORDER BY rank
+	LIMIT ?7 OFFSET ?8
+	`
+)
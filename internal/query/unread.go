@@ -0,0 +1,55 @@
+package query
+
+const (
+	// Only incoming messages can be unread, so the index stays small
+	CreateUnreadIndex = `
+	CREATE INDEX IF NOT EXISTS idx_messages_unread ON messages(chat_jid) WHERE unread = TRUE;
+	`
+
+	SelectUnreadCounts = `
+	SELECT chat_jid, COUNT(*)
+	FROM messages
+	WHERE unread = TRUE
+	GROUP BY chat_jid
+	`
+
+	SelectUnreadCountByChat = `
+	SELECT COUNT(*)
+	FROM messages
+	WHERE chat_jid = ? AND unread = TRUE
+	`
+
+	SelectUnreadMessagesByChat = `
+	SELECT message_id, sender_jid, timestamp
+	FROM messages
+	WHERE chat_jid = ? AND unread = TRUE
+	ORDER BY timestamp ASC
+	`
+
+	// MarkChatRead marks the messages of a chat up to a timestamp (?2) as read
+	MarkChatRead = `
+	UPDATE messages
+	SET unread = FALSE
+	WHERE chat_jid = ?1 AND unread = TRUE AND timestamp <= ?2
+	`
+
+	MarkMessageRead = `
+	UPDATE messages
+	SET unread = FALSE
+	WHERE chat_jid = ? AND message_id = ?
+	`
+
+	// MarkLatestMessageUnread flags the latest incoming message of a chat, used
+	// when a chat is marked as unread on another device
+	MarkLatestMessageUnread = `
+	UPDATE messages
+	SET unread = TRUE
+	WHERE message_id = (
+		SELECT message_id
+		FROM messages
+		WHERE chat_jid = ? AND is_from_me = FALSE
+		ORDER BY timestamp DESC
+		LIMIT 1
+	)
+	`
+)
@@ -1,21 +1,80 @@
 package server
 
 import (
+	"log"
 	"net/http"
+	"net/url"
 	"os"
 	"path/filepath"
 	"strings"
+	"time"
+
+	"github.com/lugvitc/whats4linux/internal/cache"
 )
 
+// MediaSource provides the files behind the /media and /avatar routes. Both
+// methods return a nil file when there is nothing to serve.
+type MediaSource interface {
+	// OpenMedia opens the media of a message, downloading it from WhatsApp
+	// when it isn't cached yet
+	OpenMedia(messageID string) (*os.File, *cache.MediaMeta, error)
+	// OpenAvatar opens the avatar of a user or group, fetching it when it
+	// isn't cached yet
+	OpenAvatar(jid string) (*os.File, *cache.MediaMeta, error)
+}
+
 type AssetFileServer struct {
 	http.Handler
+	media MediaSource
+}
+
+func NewAssetFileServer(media MediaSource) *AssetFileServer {
+	return &AssetFileServer{media: media}
+}
+
+// MediaURL returns the URL the media of a message is served at
+func MediaURL(messageID string) string {
+	return "/media/" + url.PathEscape(messageID)
 }
 
-func NewAssetFileServer() *AssetFileServer {
-	return &AssetFileServer{}
+// AvatarURL returns the URL the avatar of a JID is served at. The version,
+// usually the hash of the avatar, makes the URL change with the picture.
+func AvatarURL(jid, version string) string {
+	u := "/avatar/" + url.PathEscape(jid)
+	if version != "" {
+		u += "?v=" + url.QueryEscape(version)
+	}
+	return u
+}
+
+// inlineMime reports whether media of a mime type is shown by the app. The
+// mime comes from the sender, anything else, like HTML or SVG documents that
+// could run scripts on the app's origin, is only served as an attachment.
+func inlineMime(mime string) bool {
+	mediaType, _, _ := strings.Cut(mime, ";")
+	mediaType = strings.ToLower(strings.TrimSpace(mediaType))
+	switch {
+	case mediaType == "image/svg+xml":
+		return false
+	case strings.HasPrefix(mediaType, "image/"),
+		strings.HasPrefix(mediaType, "video/"),
+		strings.HasPrefix(mediaType, "audio/"):
+		return true
+	}
+	return false
 }
 
 func (h *AssetFileServer) ServeHTTP(res http.ResponseWriter, req *http.Request) {
+	res.Header().Set("X-Content-Type-Options", "nosniff")
+	switch {
+	case strings.HasPrefix(req.URL.Path, "/media/"):
+		h.serveCached(res, req, strings.TrimPrefix(req.URL.Path, "/media/"), h.media.OpenMedia)
+		return
+	case strings.HasPrefix(req.URL.Path, "/avatar/"):
+		h.serveCached(res, req, strings.TrimPrefix(req.URL.Path, "/avatar/"), h.media.OpenAvatar)
+		return
+	}
+
 	if strings.HasPrefix(req.URL.Path, "/cached-image/") {
 		requestedFilename := strings.TrimPrefix(req.URL.Path, "/cached-image/")
 
@@ -27,7 +86,7 @@ func (h *AssetFileServer) ServeHTTP(res http.ResponseWriter, req *http.Request)
 		}
 
 		cacheDir, _ := os.UserCacheDir()
-		fullPath := filepath.Join(cacheDir, "whats4linux", "images", requestedFilename)
+		fullPath := filepath.Join(cacheDir, "whats4linux", "media", requestedFilename)
 
 		// Check if file exists
 		if _, err := os.Stat(fullPath); os.IsNotExist(err) {
@@ -40,3 +99,43 @@ func (h *AssetFileServer) ServeHTTP(res http.ResponseWriter, req *http.Request)
 	}
 	res.WriteHeader(http.StatusNotFound)
 }
+
+// serveCached streams a cached file. Files are content addressed, so their
+// hash makes a strong ETag; http.ServeContent answers conditional and Range
+// requests with it, which lets video and audio players seek without loading
+// the whole file.
+func (h *AssetFileServer) serveCached(res http.ResponseWriter, req *http.Request, key string, open func(string) (*os.File, *cache.MediaMeta, error)) {
+	if req.Method != http.MethodGet && req.Method != http.MethodHead {
+		res.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	if h.media == nil || key == "" {
+		res.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	f, meta, err := open(key)
+	if err != nil {
+		log.Printf("[AssetFileServer] %s: %v", req.URL.Path, err)
+		res.WriteHeader(http.StatusBadGateway)
+		return
+	}
+	if f == nil {
+		res.WriteHeader(http.StatusNotFound)
+		return
+	}
+	defer f.Close()
+
+	if meta.Mime != "" {
+		res.Header().Set("Content-Type", meta.Mime)
+	}
+	if !inlineMime(meta.Mime) {
+		res.Header().Set("Content-Disposition", "attachment")
+		res.Header().Set("Content-Security-Policy", "sandbox")
+	}
+	res.Header().Set("ETag", `"`+meta.SHA256+`"`)
+	// revalidate every time, avatars change behind the same URL
+	res.Header().Set("Cache-Control", "no-cache")
+
+	http.ServeContent(res, req, "", time.Unix(meta.CreatedAt, 0), f)
+}
@@ -0,0 +1,102 @@
+package settings
+
+import (
+	mtypes "github.com/lugvitc/whats4linux/internal/types"
+)
+
+// ChatClass is the kind of chat media arrives in, as the auto-download
+// policy tells them apart. Muted chats are muted whether they are contacts
+// or groups.
+type ChatClass int
+
+const (
+	// ChatContact is a one to one chat
+	ChatContact ChatClass = iota
+	ChatGroup
+	ChatMuted
+)
+
+// AutoDownloadRule says when the media of one type is downloaded as it arrives
+type AutoDownloadRule struct {
+	Enabled bool `json:"enabled"`
+	// MaxSizeMB skips larger media, 0 disables the limit
+	MaxSizeMB int  `json:"max_size_mb"`
+	Contacts  bool `json:"contacts"`
+	Groups    bool `json:"groups"`
+	Muted     bool `json:"muted"`
+}
+
+// AutoDownloadPolicy configures the download of incoming media. Rules left
+// out of settings.json keep their defaults.
+type AutoDownloadPolicy struct {
+	Image    *AutoDownloadRule `json:"image,omitempty"`
+	Video    *AutoDownloadRule `json:"video,omitempty"`
+	Audio    *AutoDownloadRule `json:"audio,omitempty"`
+	Document *AutoDownloadRule `json:"document,omitempty"`
+	Sticker  *AutoDownloadRule `json:"sticker,omitempty"`
+	// Metered enables auto-download on metered connections
+	Metered bool `json:"metered"`
+	// Workers is the number of parallel downloads, 0 uses the default
+	Workers int `json:"workers"`
+}
+
+const defaultAutoDownloadWorkers = 3
+
+// defaultAutoDownloadRules download images and stickers everywhere but in
+// muted chats, and voice notes of contacts. Videos and documents are only
+// downloaded when opened.
+var defaultAutoDownloadRules = map[mtypes.MediaType]AutoDownloadRule{
+	mtypes.MediaTypeImage:    {Enabled: true, MaxSizeMB: 16, Contacts: true, Groups: true},
+	mtypes.MediaTypeSticker:  {Enabled: true, Contacts: true, Groups: true},
+	mtypes.MediaTypeAudio:    {Enabled: true, MaxSizeMB: 16, Contacts: true},
+	mtypes.MediaTypeVideo:    {},
+	mtypes.MediaTypeDocument: {},
+}
+
+// autoDownloadRule returns the rule of a media type, the zero rule for the
+// types that are never auto-downloaded
+func autoDownloadRule(mediaType mtypes.MediaType) AutoDownloadRule {
+	p := s.AutoDownload
+	configured := map[mtypes.MediaType]*AutoDownloadRule{
+		mtypes.MediaTypeImage:    p.Image,
+		mtypes.MediaTypeVideo:    p.Video,
+		mtypes.MediaTypeAudio:    p.Audio,
+		mtypes.MediaTypeDocument: p.Document,
+		mtypes.MediaTypeSticker:  p.Sticker,
+	}[mediaType]
+	if configured != nil {
+		return *configured
+	}
+	return defaultAutoDownloadRules[mediaType]
+}
+
+// ShouldAutoDownload reports whether incoming media of a type and size, in
+// bytes, is downloaded in a chat of the given class
+func ShouldAutoDownload(mediaType mtypes.MediaType, size uint64, class ChatClass, metered bool) bool {
+	if metered && !s.AutoDownload.Metered {
+		return false
+	}
+	rule := autoDownloadRule(mediaType)
+	if !rule.Enabled {
+		return false
+	}
+	if rule.MaxSizeMB > 0 && size > uint64(rule.MaxSizeMB)<<20 {
+		return false
+	}
+	switch class {
+	case ChatGroup:
+		return rule.Groups
+	case ChatMuted:
+		return rule.Muted
+	default:
+		return rule.Contacts
+	}
+}
+
+// GetAutoDownloadWorkers returns the number of parallel auto-downloads
+func GetAutoDownloadWorkers() int {
+	if s.AutoDownload.Workers <= 0 {
+		return defaultAutoDownloadWorkers
+	}
+	return s.AutoDownload.Workers
+}
@@ -11,8 +11,19 @@ import (
 type _settings struct {
 	Debug    bool   `json:"debug"`
 	LogLevel string `json:"log_level"`
+	// KeepRevokedMessages keeps the original content of messages
+	// that were deleted for everyone
+	KeepRevokedMessages bool `json:"keep_revoked_messages"`
+	// MediaCacheQuotaMB is the maximum size of the media cache, 0 uses the
+	// default and a negative value disables the quota
+	MediaCacheQuotaMB int `json:"media_cache_quota_mb"`
+	// AutoDownload is the policy of the download of incoming media
+	AutoDownload AutoDownloadPolicy `json:"auto_download"`
 }
 
+// defaultMediaCacheQuotaMB is the media cache quota when none is configured
+const defaultMediaCacheQuotaMB = 2048
+
 var s _settings
 
 func init() {
@@ -41,6 +52,22 @@ func GetLogLevel() string {
 	return s.LogLevel
 }
 
+func GetKeepRevokedMessages() bool {
+	return s.KeepRevokedMessages
+}
+
+// GetMediaCacheQuota returns the media cache quota in bytes, 0 when unlimited
+func GetMediaCacheQuota() int64 {
+	switch {
+	case s.MediaCacheQuotaMB < 0:
+		return 0
+	case s.MediaCacheQuotaMB == 0:
+		return defaultMediaCacheQuotaMB << 20
+	default:
+		return int64(s.MediaCacheQuotaMB) << 20
+	}
+}
+
 func GetCustomCSS() string {
 	b, err := os.ReadFile(
 		filepath.Join(misc.ConfigDir, "custom.css"),
@@ -0,0 +1,54 @@
+package store
+
+import (
+	"database/sql"
+
+	"github.com/lugvitc/whats4linux/internal/query"
+)
+
+// MessageEdit is a prior version of an edited message. Timestamp is when
+// this version was written, EditedAt is when EditorJID replaced it.
+type MessageEdit struct {
+	ID        int    `json:"id"`
+	MessageID string `json:"message_id"`
+	Text      string `json:"text"`
+	// HTML is Text rendered for display
+	HTML      string `json:"html"`
+	Timestamp int64  `json:"timestamp"`
+	EditedAt  int64  `json:"edited_at"`
+	EditorJID string `json:"editor_jid"`
+}
+
+// GetMessageEditHistory returns the prior versions of a message, oldest first
+func (ms *MessageStore) GetMessageEditHistory(chatJID, messageID string) ([]MessageEdit, error) {
+	rows, err := ms.db.Query(query.SelectMessageEditsByChatAndID, chatJID, messageID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	edits := []MessageEdit{}
+	for rows.Next() {
+		var (
+			edit     MessageEdit
+			text     sql.NullString
+			mentions sql.NullString
+		)
+		err := rows.Scan(
+			&edit.ID,
+			&edit.MessageID,
+			&text,
+			&mentions,
+			&edit.Timestamp,
+			&edit.EditedAt,
+			&edit.EditorJID,
+		)
+		if err != nil {
+			return nil, err
+		}
+		edit.Text = text.String
+		edit.HTML = ms.RenderText(edit.Text, decodeMentions(mentions.String))
+		edits = append(edits, edit)
+	}
+	return edits, rows.Err()
+}
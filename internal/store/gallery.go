@@ -0,0 +1,213 @@
+package store
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/lugvitc/whats4linux/internal/markdown"
+	"github.com/lugvitc/whats4linux/internal/query"
+	mtypes "github.com/lugvitc/whats4linux/internal/types"
+)
+
+// GalleryItem is a media message or a link of a chat's gallery
+type GalleryItem struct {
+	MessageID string           `json:"message_id"`
+	Sender    string           `json:"sender"`
+	Timestamp int64            `json:"timestamp"`
+	Type      mtypes.MediaType `json:"type"`
+	Mimetype  string           `json:"mimetype,omitempty"`
+	FileName  string           `json:"file_name,omitempty"`
+	Width     int              `json:"width,omitempty"`
+	Height    int              `json:"height,omitempty"`
+	Seconds   uint32           `json:"seconds,omitempty"`
+	// Text is the caption of media, or the text a link was sent in
+	Text string `json:"text,omitempty"`
+	// URL is the link of link items
+	URL string `json:"url,omitempty"`
+	// Thumbnail is the URL of the cached media, empty when not downloaded
+	Thumbnail string `json:"thumbnail,omitempty"`
+}
+
+// GalleryPage is a page of a chat's gallery. NextCursor fetches the next,
+// older, page and is empty on the last one.
+type GalleryPage struct {
+	Items      []GalleryItem `json:"items"`
+	NextCursor string        `json:"next_cursor,omitempty"`
+}
+
+// parseCursor splits a "timestamp:key" gallery cursor, an empty cursor
+// starts from the newest item
+func parseCursor(cursor string) (timestamp int64, key string, err error) {
+	if cursor == "" {
+		return math.MaxInt64, "", nil
+	}
+	ts, key, ok := strings.Cut(cursor, ":")
+	if !ok {
+		return 0, "", fmt.Errorf("invalid cursor %q", cursor)
+	}
+	timestamp, err = strconv.ParseInt(ts, 10, 64)
+	if err != nil {
+		return 0, "", fmt.Errorf("invalid cursor %q", cursor)
+	}
+	return timestamp, key, nil
+}
+
+func formatCursor(timestamp int64, key string) string {
+	return strconv.FormatInt(timestamp, 10) + ":" + key
+}
+
+// ListChatMedia returns a page of the media of the given types sent in a
+// chat, newest first
+func (ms *MessageStore) ListChatMedia(chatJID string, types []mtypes.MediaType, cursor string, limit int) (*GalleryPage, error) {
+	if len(types) == 0 || len(types) > 2 {
+		return nil, fmt.Errorf("expected one or two media types, got %d", len(types))
+	}
+	beforeTS, beforeID, err := parseCursor(cursor)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := ms.db.Query(query.SelectChatMediaPage,
+		chatJID, types[0], types[len(types)-1], beforeTS, beforeID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	page := &GalleryPage{Items: []GalleryItem{}}
+	for rows.Next() {
+		var (
+			item               GalleryItem
+			text, mime, name   sql.NullString
+			width, height, sec sql.NullInt64
+		)
+		err := rows.Scan(
+			&item.MessageID, &item.Sender, &item.Timestamp, &text,
+			&item.Type, &mime, &name, &width, &height, &sec,
+		)
+		if err != nil {
+			return nil, err
+		}
+		item.Text = text.String
+		item.Mimetype = mime.String
+		item.FileName = name.String
+		item.Width, item.Height = int(width.Int64), int(height.Int64)
+		item.Seconds = uint32(sec.Int64)
+		page.Items = append(page.Items, item)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(page.Items) == limit {
+		last := page.Items[len(page.Items)-1]
+		page.NextCursor = formatCursor(last.Timestamp, last.MessageID)
+	}
+	return page, nil
+}
+
+// ListChatLinks returns a page of the links sent in a chat, newest first
+func (ms *MessageStore) ListChatLinks(chatJID, cursor string, limit int) (*GalleryPage, error) {
+	beforeTS, key, err := parseCursor(cursor)
+	if err != nil {
+		return nil, err
+	}
+	beforeID := int64(math.MaxInt64)
+	if key != "" {
+		beforeID, err = strconv.ParseInt(key, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid cursor %q", cursor)
+		}
+	}
+
+	rows, err := ms.db.Query(query.SelectChatLinksPage, chatJID, beforeTS, beforeID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	page := &GalleryPage{Items: []GalleryItem{}}
+	var lastID int64
+	for rows.Next() {
+		var (
+			item GalleryItem
+			text sql.NullString
+		)
+		err := rows.Scan(&lastID, &item.MessageID, &item.Sender, &item.Timestamp, &item.URL, &text)
+		if err != nil {
+			return nil, err
+		}
+		item.Text = text.String
+		page.Items = append(page.Items, item)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(page.Items) == limit {
+		last := page.Items[len(page.Items)-1]
+		page.NextCursor = formatCursor(last.Timestamp, strconv.FormatInt(lastID, 10))
+	}
+	return page, nil
+}
+
+// indexMessageLinks (re)writes the links index entries of a message. The
+// message must be inserted first, the entries copy its chat and timestamp.
+func indexMessageLinks(tx *sql.Tx, messageID, text string) error {
+	_, err := tx.Exec(query.DeleteMessageLinks, messageID)
+	if err != nil {
+		return err
+	}
+	for _, link := range markdown.ExtractLinks(text) {
+		_, err = tx.Exec(query.InsertMessageLink, link, messageID)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// backfillLinks indexes the links of the messages stored before
+// message_links existed
+func backfillLinks(tx *sql.Tx) error {
+	rows, err := tx.Query(query.SelectMessagesWithLinks)
+	if err != nil {
+		return err
+	}
+
+	type pending struct {
+		messageID string
+		text      string
+	}
+	var candidates []pending
+	for rows.Next() {
+		var (
+			p    pending
+			text sql.NullString
+		)
+		if err := rows.Scan(&p.messageID, &text); err != nil {
+			rows.Close()
+			return err
+		}
+		p.text = text.String
+		candidates = append(candidates, p)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, p := range candidates {
+		if err := indexMessageLinks(tx, p.messageID, p.text); err != nil {
+			return err
+		}
+	}
+	if len(candidates) > 0 {
+		log.Printf("Backfilled links index with %d messages\n", len(candidates))
+	}
+	return nil
+}
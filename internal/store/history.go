@@ -0,0 +1,167 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/lugvitc/whats4linux/internal/query"
+	"go.mau.fi/whatsmeow/proto/waE2E"
+	"go.mau.fi/whatsmeow/store"
+	"go.mau.fi/whatsmeow/types"
+)
+
+// HistoryMessage is a message decoded from a history sync chunk
+type HistoryMessage struct {
+	Info    types.MessageInfo
+	Message *waE2E.Message
+	// Status is the delivery state of our own messages
+	Status MessageStatus
+	// Unread is set for the incoming messages the chat's unread count covers
+	Unread bool
+	// Reactions attached to the message by the history sync
+	Reactions []Reaction
+}
+
+// InsertHistoryMessages bulk-inserts the messages of a history sync chunk,
+// along with their media metadata and reactions, in a single transaction.
+// Messages that are already stored are left untouched. It returns the number
+// of newly inserted messages.
+func (ms *MessageStore) InsertHistoryMessages(ctx context.Context, sd store.LIDStore, msgs []HistoryMessage) (int, error) {
+	if len(msgs) == 0 {
+		return 0, nil
+	}
+
+	for i := range msgs {
+		updateCanonicalJID(ctx, sd, &msgs[i].Info.Chat)
+		updateCanonicalJID(ctx, sd, &msgs[i].Info.Sender)
+	}
+
+	var inserted int
+	err := ms.runSync(func(tx *sql.Tx) error {
+		stmtMessage, err := tx.Prepare(query.InsertMessageIfMissing)
+		if err != nil {
+			return err
+		}
+		defer stmtMessage.Close()
+
+		stmtMedia, err := tx.Prepare(query.InsertMessageMediaIfMissing)
+		if err != nil {
+			return err
+		}
+		defer stmtMedia.Close()
+
+		inserted = 0
+		// reactions are applied once every message of the chunk is stored,
+		// a reaction can come before the message it targets
+		var reactions []Reaction
+		for _, hm := range msgs {
+			// protocol messages (edits, revokes...) only make sense live
+			if hm.Message.GetProtocolMessage() != nil {
+				continue
+			}
+
+			if reactionMsg := hm.Message.GetReactionMessage(); reactionMsg != nil {
+				reactions = append(reactions, Reaction{
+					MessageID: reactionMsg.GetKey().GetID(),
+					SenderID:  hm.Info.Sender.ToNonAD().String(),
+					Emoji:     reactionMsg.GetText(),
+				})
+				continue
+			}
+			for _, reaction := range hm.Reactions {
+				reaction.MessageID = hm.Info.ID
+				reactions = append(reactions, reaction)
+			}
+
+			text, fileName, replyToMessageID, forwarded, emc, mediaType, width, height := extractMessageContent(hm.Message)
+			audio := extractAudioInfo(hm.Message)
+
+			res, err := stmtMessage.Exec(
+				hm.Info.ID,
+				hm.Info.Chat.String(),
+				hm.Info.Sender.String(),
+				hm.Info.Timestamp.Unix(),
+				hm.Info.IsFromMe,
+				text,
+				encodeMentions(extractMentions(hm.Message)),
+				emc != nil,
+				replyToMessageID,
+				false,
+				forwarded,
+				hm.Status,
+				hm.Unread,
+			)
+			if err != nil {
+				return err
+			}
+
+			if n, _ := res.RowsAffected(); n == 0 {
+				continue
+			}
+			inserted++
+
+			err = indexMessageText(tx, hm.Info.ID, text)
+			if err != nil {
+				return err
+			}
+			err = indexMessageLinks(tx, hm.Info.ID, text)
+			if err != nil {
+				return err
+			}
+			if emc == nil {
+				continue
+			}
+			_, err = stmtMedia.Exec(
+				hm.Info.ID,
+				mediaType,
+				emc.GetURL(),
+				emc.GetMimetype(),
+				emc.GetDirectPath(),
+				emc.GetMediaKey(),
+				emc.GetFileSHA256(),
+				emc.GetFileEncSHA256(),
+				width, height,
+				fileName,
+				audio.Seconds, audio.Waveform, audio.PTT,
+			)
+			if err != nil {
+				return err
+			}
+		}
+
+		for _, reaction := range reactions {
+			err = setReactionTx(tx, reaction.MessageID, reaction.Emoji, reaction.SenderID)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	// Drop the cached chat list entries and reactions touched by the sync,
+	// they get reloaded from messages.db on the next read
+	for _, hm := range msgs {
+		ms.chatListMap.Delete(hm.Info.Chat.User)
+		if reactionMsg := hm.Message.GetReactionMessage(); reactionMsg != nil {
+			ms.reactionCache.Delete(reactionMsg.GetKey().GetID())
+		} else if len(hm.Reactions) > 0 {
+			ms.reactionCache.Delete(hm.Info.ID)
+		}
+	}
+
+	return inserted, nil
+}
+
+// setReactionTx replaces the reaction of a sender on a message, an empty
+// emoji removes it
+func setReactionTx(tx *sql.Tx, targetID, emoji, senderJID string) error {
+	_, err := tx.Exec(query.DeleteReactionsByMessageIDAndSenderID, targetID, senderJID)
+	if err != nil || emoji == "" {
+		return err
+	}
+	_, err = tx.Exec(query.InsertReactionIfMessageExists, targetID, senderJID, emoji)
+	return err
+}
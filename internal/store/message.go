@@ -6,8 +6,10 @@ import (
 	"log"
 	"time"
 
+	"github.com/lugvitc/whats4linux/internal/migration"
 	"github.com/lugvitc/whats4linux/internal/misc"
 	"github.com/lugvitc/whats4linux/internal/query"
+	appsettings "github.com/lugvitc/whats4linux/internal/settings"
 	mtypes "github.com/lugvitc/whats4linux/internal/types"
 	"github.com/lugvitc/whats4linux/internal/wa"
 	"go.mau.fi/whatsmeow/proto/waE2E"
@@ -30,6 +32,7 @@ type ExtendedMessage struct {
 	Media            *wa.Media
 	Edited           bool
 	Forwarded        bool
+	Deleted          bool
 	Reactions        []Reaction
 }
 
@@ -39,6 +42,7 @@ type ChatMessage struct {
 	MessageText string
 	MessageTime int64
 	Sender      string
+	UnreadCount int
 }
 
 // DecodedMessage represents a message from messages.db with decoded fields
@@ -47,7 +51,11 @@ type DecodedMessage struct {
 	ReplyToMessageID string           `json:"reply_to_message_id"`
 	Edited           bool             `json:"edited"`
 	Forwarded        bool             `json:"forwarded"`
-	Reactions        []Reaction       `json:"reactions"`
+	Deleted          bool             `json:"deleted"`
+	Status           string           `json:"status,omitempty"`
+	// Text is the raw text of the message, Content holds it rendered as HTML
+	Text      string     `json:"text,omitempty"`
+	Reactions []Reaction `json:"reactions"`
 	// Info provides compatibility with frontend that expects types.MessageInfo structure
 	Info DecodedMessageInfo `json:"Info"`
 	// Content provides a minimal content structure for frontend rendering
@@ -70,7 +78,7 @@ type DecodedMessageContent struct {
 	ExtendedTextMessage *ExtendedTextContent    `json:"extendedTextMessage,omitempty"`
 	ImageMessage        *MediaMessageContent    `json:"imageMessage,omitempty"`
 	VideoMessage        *MediaMessageContent    `json:"videoMessage,omitempty"`
-	AudioMessage        *MediaMessageContent    `json:"audioMessage,omitempty"`
+	AudioMessage        *AudioMessageContent    `json:"audioMessage,omitempty"`
 	DocumentMessage     *DocumentMessageContent `json:"documentMessage,omitempty"`
 	StickerMessage      *MediaMessageContent    `json:"stickerMessage,omitempty"`
 }
@@ -86,6 +94,17 @@ type MediaMessageContent struct {
 	ContextInfo *ContextInfo `json:"contextInfo,omitempty"`
 }
 
+// AudioMessageContent is the content of audio messages. Voice notes (PTT)
+// carry their duration and waveform, so they can be drawn without
+// downloading the audio.
+type AudioMessageContent struct {
+	Mimetype    string       `json:"mimetype,omitempty"`
+	Seconds     uint32       `json:"seconds,omitempty"`
+	PTT         bool         `json:"ptt,omitempty"`
+	Waveform    []int        `json:"waveform,omitempty"`
+	ContextInfo *ContextInfo `json:"contextInfo,omitempty"`
+}
+
 type DocumentMessageContent struct {
 	Caption     string       `json:"caption,omitempty"`
 	FileName    string       `json:"fileName,omitempty"`
@@ -101,6 +120,88 @@ type ContextInfo struct {
 
 type writeJob func(*sql.Tx) error
 
+// messagesMigrations is the schema history of messages.db, append only
+var messagesMigrations = []migration.Migration{
+	// 1: base schema
+	migration.Exec(
+		query.CreateMessagesTable,
+		query.CreateMessageMediaTable,
+		query.CreateReactionsTable,
+	),
+	// 2: revoked messages
+	migration.AddColumn("messages", "deleted", "BOOLEAN DEFAULT FALSE"),
+	// 3: edit history
+	migration.Exec(query.CreateMessageEditsTable),
+	// 4: full-text search
+	func(tx *sql.Tx) error {
+		_, err := tx.Exec(query.CreateMessagesFTSTable)
+		if err != nil {
+			return err
+		}
+		return backfillSearchIndex(tx)
+	},
+	// 5: delivery and read receipts
+	func(tx *sql.Tx) error {
+		err := migration.AddColumn("messages", "status", "INTEGER DEFAULT 0")(tx)
+		if err != nil {
+			return err
+		}
+		return migration.Exec(
+			query.CreateMessageReceiptsTable,
+			query.MarkOwnMessagesSent,
+		)(tx)
+	},
+	// 6: unread messages
+	func(tx *sql.Tx) error {
+		err := migration.AddColumn("messages", "unread", "BOOLEAN DEFAULT FALSE")(tx)
+		if err != nil {
+			return err
+		}
+		return migration.Exec(query.CreateUnreadIndex)(tx)
+	},
+	// 7: raw message text and mentions, rendered when read
+	func(tx *sql.Tx) error {
+		err := migration.AddColumn("messages", "mentions", "TEXT")(tx)
+		if err != nil {
+			return err
+		}
+		return migrateRenderedText(tx)
+	},
+	// 8: duration and waveform of voice notes
+	func(tx *sql.Tx) error {
+		for _, col := range [][2]string{
+			{"seconds", "INTEGER"},
+			{"waveform", "BLOB"},
+			{"ptt", "BOOLEAN DEFAULT FALSE"},
+		} {
+			err := migration.AddColumn("message_media", col[0], col[1])(tx)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	},
+	// 9: links index
+	func(tx *sql.Tx) error {
+		_, err := tx.Exec(query.CreateMessageLinksTable)
+		if err != nil {
+			return err
+		}
+		return backfillLinks(tx)
+	},
+	// 10: mentions of the prior versions of edited messages
+	func(tx *sql.Tx) error {
+		err := migration.AddColumn("message_edits", "mentions", "TEXT")(tx)
+		if err != nil {
+			return err
+		}
+		return migration.Exec(query.SetMessageEditMentions)(tx)
+	},
+	// 11: links indexed before their href was normalized, like
+	// "www.x.com/?r=http://y", were stored without a scheme
+	backfillLinks,
+}
+
 type MessageStore struct {
 	db *sql.DB
 
@@ -108,6 +209,8 @@ type MessageStore struct {
 	chatListMap   misc.VMap[string, ChatMessage]
 	reactionCache misc.NMap[string, string, []string]
 
+	mentionName MentionNameFunc
+
 	stmtInsertMessage *sql.Stmt
 	stmtInsertMedia   *sql.Stmt
 	stmtUpdateMessage *sql.Stmt
@@ -129,26 +232,14 @@ func NewMessageStore() (*MessageStore, error) {
 		writeCh:       make(chan writeJob, 100),
 	}
 
-	go ms.runWriter()
-
-	err = ms.runSync(func(tx *sql.Tx) error {
-		_, err := tx.Exec(query.CreateMessagesTable)
-		if err != nil {
-			return err
-		}
-		_, err = tx.Exec(query.CreateMessageMediaTable)
-		if err != nil {
-			return err
-		}
-		_, err = tx.Exec(query.CreateReactionsTable)
-		return err
-	})
-
+	err = migration.Apply(db, "messages.db", messagesMigrations)
 	if err != nil {
 		db.Close()
 		return nil, err
 	}
 
+	go ms.runWriter()
+
 	err = ms.runSync(func(tx *sql.Tx) error {
 		var err error
 		ms.stmtInsertMessage, err = tx.Prepare(query.InsertMessage)
@@ -377,7 +468,7 @@ func (ms *MessageStore) migrateChatlist(ctx context.Context, sd store.LIDStore,
 }
 
 // ProcessMessageEvent processes a new message event and stores it in messages.db
-func (ms *MessageStore) ProcessMessageEvent(ctx context.Context, sd store.LIDStore, msg *events.Message, parsedHTML string) string {
+func (ms *MessageStore) ProcessMessageEvent(ctx context.Context, sd store.LIDStore, msg *events.Message) string {
 	ms.migrateChatlist(ctx, sd, msg.Info.Chat)
 
 	updateCanonicalJID(ctx, sd, &msg.Info.Chat)
@@ -391,7 +482,7 @@ func (ms *MessageStore) ProcessMessageEvent(ctx context.Context, sd store.LIDSto
 			return ""
 		}
 
-		err := ms.UpdateMessageContent(targetID, newContent, parsedHTML)
+		err := ms.UpdateMessageContent(targetID, &msg.Info, newContent)
 		if err != nil {
 			log.Println("Failed to update edited message:", err)
 			return ""
@@ -399,13 +490,28 @@ func (ms *MessageStore) ProcessMessageEvent(ctx context.Context, sd store.LIDSto
 		return targetID
 	}
 
+	// Handle message revokes ("delete for everyone")
+	if protoMsg := msg.Message.GetProtocolMessage(); protoMsg != nil && protoMsg.GetType() == waE2E.ProtocolMessage_REVOKE {
+		targetID := protoMsg.GetKey().GetID()
+		if targetID == "" {
+			return ""
+		}
+
+		err := ms.RevokeMessage(targetID, appsettings.GetKeepRevokedMessages())
+		if err != nil {
+			log.Println("Failed to revoke message:", err)
+			return ""
+		}
+		// the revoked message may be the latest one of the chat, reload it from db
+		ms.chatListMap.Delete(msg.Info.Chat.User)
+		return targetID
+	}
+
 	chat := msg.Info.Chat.User
 
 	// Update chatListMap with the new latest message
-	var messageText string
-	if parsedHTML != "" {
-		messageText = parsedHTML
-	} else {
+	messageText := ms.RenderMessage(msg.Message)
+	if messageText == "" {
 		messageText = ExtractMessageText(msg.Message)
 	}
 	sender := msg.Info.PushName
@@ -426,7 +532,7 @@ func (ms *MessageStore) ProcessMessageEvent(ctx context.Context, sd store.LIDSto
 
 	ms.chatListMap.Set(chat, chatMsg)
 
-	err := ms.InsertMessage(&msg.Info, msg.Message, parsedHTML)
+	err := ms.InsertMessage(&msg.Info, msg.Message)
 	if err != nil {
 		log.Println("Failed to insert message:", err)
 		return ""
@@ -435,13 +541,13 @@ func (ms *MessageStore) ProcessMessageEvent(ctx context.Context, sd store.LIDSto
 }
 
 // InsertMessage inserts a new message into messages.db
-func (ms *MessageStore) InsertMessage(info *types.MessageInfo, msg *waE2E.Message, parsedHTML string) error {
+func (ms *MessageStore) InsertMessage(info *types.MessageInfo, msg *waE2E.Message) error {
 	// Handle reaction messages differently
 	if msg.GetReactionMessage() != nil {
 		reactionMsg := msg.GetReactionMessage()
 		targetID := reactionMsg.GetKey().GetID()
 		reaction := reactionMsg.GetText()
-		senderJID := info.Sender.String()
+		senderJID := info.Sender.ToNonAD().String()
 		return ms.AddReactionToMessage(targetID, reaction, senderJID)
 	}
 
@@ -454,10 +560,8 @@ func (ms *MessageStore) InsertMessage(info *types.MessageInfo, msg *waE2E.Messag
 	)
 
 	text, fileName, replyToMessageID, forwarded, emc, mediaType, width, height = extractMessageContent(msg)
-
-	if parsedHTML != "" {
-		text = parsedHTML
-	}
+	mentions := encodeMentions(extractMentions(msg))
+	audio := extractAudioInfo(msg)
 
 	return ms.runSync(func(tx *sql.Tx) error {
 		_, err := tx.Stmt(ms.stmtInsertMessage).Exec(
@@ -467,14 +571,25 @@ func (ms *MessageStore) InsertMessage(info *types.MessageInfo, msg *waE2E.Messag
 			info.Timestamp.Unix(),
 			info.IsFromMe,
 			text,
+			mentions,
 			emc != nil,
 			replyToMessageID,
 			false,
 			forwarded,
+			initialStatus(info.IsFromMe),
+			isUnread(info, msg),
 		)
 		if err != nil {
 			return err
 		}
+		err = indexMessageText(tx, info.ID, text)
+		if err != nil {
+			return err
+		}
+		err = indexMessageLinks(tx, info.ID, text)
+		if err != nil {
+			return err
+		}
 		// no media to process
 		if emc == nil {
 			return nil
@@ -490,13 +605,15 @@ func (ms *MessageStore) InsertMessage(info *types.MessageInfo, msg *waE2E.Messag
 			emc.GetFileEncSHA256(),
 			width, height,
 			fileName,
+			audio.Seconds, audio.Waveform, audio.PTT,
 		)
 		return err
 	})
 }
 
-// UpdateMessageContent updates an existing message's content
-func (ms *MessageStore) UpdateMessageContent(messageID string, content *waE2E.Message, parsedHTML string) error {
+// UpdateMessageContent updates an existing message's content, keeping
+// the previous text in message_edits. editInfo is the info of the edit event.
+func (ms *MessageStore) UpdateMessageContent(messageID string, editInfo *types.MessageInfo, content *waE2E.Message) error {
 
 	var (
 		text, fileName string
@@ -510,19 +627,36 @@ func (ms *MessageStore) UpdateMessageContent(messageID string, content *waE2E.Me
 	if text == "" {
 		return nil
 	}
-
-	if parsedHTML != "" {
-		text = parsedHTML
-	}
+	mentions := encodeMentions(extractMentions(content))
+	audio := extractAudioInfo(content)
 
 	return ms.runSync(func(tx *sql.Tx) error {
-		_, err := tx.Stmt(ms.stmtUpdateMessage).Exec(
+		_, err := tx.Exec(
+			query.InsertMessageEdit,
+			editInfo.Timestamp.Unix(),
+			editInfo.Sender.String(),
+			messageID,
 			text,
+		)
+		if err != nil {
+			return err
+		}
+		_, err = tx.Stmt(ms.stmtUpdateMessage).Exec(
+			text,
+			mentions,
 			messageID,
 		)
 		if err != nil {
 			return err
 		}
+		err = indexMessageText(tx, messageID, text)
+		if err != nil {
+			return err
+		}
+		err = indexMessageLinks(tx, messageID, text)
+		if err != nil {
+			return err
+		}
 		// no media to process
 		if emc == nil {
 			return nil
@@ -538,12 +672,73 @@ func (ms *MessageStore) UpdateMessageContent(messageID string, content *waE2E.Me
 			emc.GetFileEncSHA256(),
 			width, height,
 			fileName,
+			audio.Seconds, audio.Waveform, audio.PTT,
 			messageID,
 		)
 		return err
 	})
 }
 
+// UpdateMediaDirectPath replaces the download path of the media of a message,
+// after a media retry
+func (ms *MessageStore) UpdateMediaDirectPath(messageID, directPath string) error {
+	return ms.runSync(func(tx *sql.Tx) error {
+		_, err := tx.Exec(query.UpdateMessageMediaDirectPath, directPath, messageID)
+		return err
+	})
+}
+
+// RevokeMessage marks a message as deleted for everyone. Unless keepContent
+// is set, its text, media and edit history are dropped from the store.
+func (ms *MessageStore) RevokeMessage(messageID string, keepContent bool) error {
+	return ms.runSync(func(tx *sql.Tx) error {
+		if keepContent {
+			_, err := tx.Exec(query.MarkMessageRevoked, messageID)
+			return err
+		}
+		_, err := tx.Exec(query.DeleteMessageFTS, messageID)
+		if err != nil {
+			return err
+		}
+		_, err = tx.Exec(query.ClearRevokedMessage, messageID)
+		if err != nil {
+			return err
+		}
+		_, err = tx.Exec(query.DeleteMessageMediaByMessageID, messageID)
+		if err != nil {
+			return err
+		}
+		_, err = tx.Exec(query.DeleteMessageLinks, messageID)
+		if err != nil {
+			return err
+		}
+		_, err = tx.Exec(query.DeleteMessageEditsByMessageID, messageID)
+		return err
+	})
+}
+
+// DeleteMessage removes a message and everything attached to it from the store
+func (ms *MessageStore) DeleteMessage(chat types.JID, messageID string) error {
+	// the message may be the latest one of the chat, reload it from db
+	defer ms.chatListMap.Delete(chat.User)
+	return ms.runSync(func(tx *sql.Tx) error {
+		for _, q := range []string{
+			query.DeleteMessageFTS,
+			query.DeleteMessageMediaByMessageID,
+			query.DeleteMessageLinks,
+			query.DeleteMessageEditsByMessageID,
+			query.DeleteMessageReceiptsByMessageID,
+			query.DeleteMessage,
+		} {
+			_, err := tx.Exec(q, messageID)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
 // GetMessageWithRaw returns a message with its raw protobuf content for media download
 func (ms *MessageStore) GetMessageWithMedia(chatJID string, messageID string) (*ExtendedMessage, error) {
 	var (
@@ -555,6 +750,7 @@ func (ms *MessageStore) GetMessageWithMedia(chatJID string, messageID string) (*
 		replyTo   sql.NullString
 		edited    bool
 		forwarded bool
+		deleted   bool
 	)
 
 	err := ms.db.QueryRow(query.SelectMessageByChatAndID, chatJID, messageID).Scan(
@@ -566,6 +762,7 @@ func (ms *MessageStore) GetMessageWithMedia(chatJID string, messageID string) (*
 		&replyTo,
 		&edited,
 		&forwarded,
+		&deleted,
 	)
 
 	if err != nil {
@@ -631,6 +828,7 @@ func (ms *MessageStore) GetMessageWithMedia(chatJID string, messageID string) (*
 		Media:            media,
 		Edited:           edited,
 		Forwarded:        forwarded,
+		Deleted:          deleted,
 	}, nil
 }
 
@@ -646,6 +844,7 @@ func (ms *MessageStore) GetMessageWithMediaByID(messageID string) (*ExtendedMess
 		replyTo   sql.NullString
 		edited    bool
 		forwarded bool
+		deleted   bool
 	)
 
 	err := ms.db.QueryRow(query.SelectMessageByID, messageID).Scan(
@@ -658,6 +857,7 @@ func (ms *MessageStore) GetMessageWithMediaByID(messageID string) (*ExtendedMess
 		&replyTo,
 		&edited,
 		&forwarded,
+		&deleted,
 	)
 
 	if err != nil {
@@ -675,6 +875,7 @@ func (ms *MessageStore) GetMessageWithMediaByID(messageID string) (*ExtendedMess
 			url           sql.NullString
 			mimetype      sql.NullString
 			directPath    sql.NullString
+			fileName      sql.NullString
 			mediaKey      []byte
 			fileSHA256    []byte
 			fileEncSHA256 []byte
@@ -690,6 +891,7 @@ func (ms *MessageStore) GetMessageWithMediaByID(messageID string) (*ExtendedMess
 			&fileEncSHA256,
 			&width,
 			&height,
+			&fileName,
 		)
 		if err != nil {
 			return nil, err
@@ -719,6 +921,7 @@ func (ms *MessageStore) GetMessageWithMediaByID(messageID string) (*ExtendedMess
 		Media:            media,
 		Edited:           edited,
 		Forwarded:        forwarded,
+		Deleted:          deleted,
 	}, nil
 }
 
@@ -731,6 +934,12 @@ func (ms *MessageStore) GetChatList() []ChatMessage {
 	}
 	defer rows.Close()
 
+	// unread counts change too often to be cached with the chat entries
+	unreadCounts, err := ms.GetUnreadCounts()
+	if err != nil {
+		log.Println("Failed to query unread counts:", err)
+	}
+
 	var chatList []ChatMessage
 
 	for rows.Next() {
@@ -742,10 +951,13 @@ func (ms *MessageStore) GetChatList() []ChatMessage {
 			isFromMe  bool
 			msgType   sql.NullInt32
 			text      sql.NullString
+			mentions  sql.NullString
 			replyTo   sql.NullString
 			fileName  sql.NullString
 			edited    bool
 			forwarded bool
+			deleted   bool
+			status    int
 		)
 
 		if err := rows.Scan(
@@ -755,9 +967,12 @@ func (ms *MessageStore) GetChatList() []ChatMessage {
 			&timestamp,
 			&isFromMe,
 			&text,
+			&mentions,
 			&replyTo,
 			&edited,
 			&forwarded,
+			&deleted,
+			&status,
 			&msgType,
 			&fileName,
 		); err != nil {
@@ -772,13 +987,14 @@ func (ms *MessageStore) GetChatList() []ChatMessage {
 
 		// Check per-chat cache first
 		if cachedChat, ok := ms.chatListMap.Get(jid.User); ok {
+			cachedChat.UnreadCount = unreadCounts[chatJID]
 			chatList = append(chatList, cachedChat)
 			continue
 		}
 
 		var messageText string
 		if text.Valid {
-			messageText = text.String
+			messageText = ms.RenderText(text.String, decodeMentions(mentions.String))
 		}
 
 		chatMsg := ChatMessage{
@@ -790,6 +1006,7 @@ func (ms *MessageStore) GetChatList() []ChatMessage {
 
 		// Cache per-chat entry
 		ms.chatListMap.Set(jid.User, chatMsg)
+		chatMsg.UnreadCount = unreadCounts[chatJID]
 		chatList = append(chatList, chatMsg)
 	}
 	return chatList
@@ -890,13 +1107,15 @@ func (ms *MessageStore) AddReactionToMessage(targetID, reaction, senderJID strin
 	if err != nil {
 		return err
 	}
-	// Update cache: remove sender from all emojis, then add to new emoji
+	// Update cache: remove sender from all emojis, then add to new emoji.
+	// Messages that aren't cached yet are loaded from db on the next read,
+	// caching only this reaction would hide the others.
 	underlying, mu := ms.reactionCache.GetMapWithMutex()
 	mu.Lock()
-	inner := underlying[targetID]
-	if inner == nil {
-		inner = make(map[string][]string)
-		underlying[targetID] = inner
+	inner, ok := underlying[targetID]
+	if !ok {
+		mu.Unlock()
+		return nil
 	}
 	// Remove from all
 	for emoji, senders := range inner {
@@ -967,6 +1186,43 @@ func extractMessageContent(msg *waE2E.Message) (text, fileName, replyToMessageID
 	return
 }
 
+// audioInfo is what's stored of audio messages besides the media itself
+type audioInfo struct {
+	Seconds  uint32
+	Waveform []byte
+	PTT      bool
+}
+
+// extractAudioInfo returns the duration and waveform of an audio message,
+// the zero value for other messages
+func extractAudioInfo(msg *waE2E.Message) audioInfo {
+	audio := msg.GetAudioMessage()
+	if audio == nil {
+		return audioInfo{}
+	}
+	return audioInfo{
+		Seconds:  audio.GetSeconds(),
+		Waveform: audio.GetWaveform(),
+		PTT:      audio.GetPTT(),
+	}
+}
+
+// getAudioInfo returns the duration and waveform of a stored audio message
+func (ms *MessageStore) getAudioInfo(messageID string) (audioInfo, error) {
+	var (
+		audio   audioInfo
+		seconds sql.NullInt64
+		ptt     sql.NullBool
+	)
+	err := ms.db.QueryRow(query.SelectAudioInfoByMessageID, messageID).Scan(&seconds, &audio.Waveform, &ptt)
+	if err == sql.ErrNoRows {
+		return audio, nil
+	}
+	audio.Seconds = uint32(seconds.Int64)
+	audio.PTT = ptt.Bool
+	return audio, err
+}
+
 // GetDecodedMessagesPaged returns a page of decoded messages from messages.db
 func (ms *MessageStore) GetDecodedMessagesPaged(chatJID string, beforeTimestamp int64, limit int) ([]DecodedMessage, error) {
 	var rows *sql.Rows
@@ -993,8 +1249,11 @@ func (ms *MessageStore) GetDecodedMessagesPaged(chatJID string, beforeTimestamp
 			timestamp         int64
 			isFromMe          bool
 			text              sql.NullString
+			mentions          sql.NullString
 			replyTo           sql.NullString
 			edited, forwarded bool
+			deleted           bool
+			status            int
 			msgType           sql.NullInt32
 			fileName          sql.NullString
 		)
@@ -1006,9 +1265,12 @@ func (ms *MessageStore) GetDecodedMessagesPaged(chatJID string, beforeTimestamp
 			&timestamp,
 			&isFromMe,
 			&text,
+			&mentions,
 			&replyTo,
 			&edited,
 			&forwarded,
+			&deleted,
+			&status,
 			&msgType,
 			&fileName,
 		)
@@ -1022,6 +1284,9 @@ func (ms *MessageStore) GetDecodedMessagesPaged(chatJID string, beforeTimestamp
 			ReplyToMessageID: replyTo.String,
 			Edited:           edited,
 			Forwarded:        forwarded,
+			Deleted:          deleted,
+			Status:           decodedStatus(isFromMe, status),
+			Text:             text.String,
 			Info: DecodedMessageInfo{
 				ID:        msgId,
 				Timestamp: time.Unix(timestamp, 0).Format(time.RFC3339),
@@ -1039,7 +1304,7 @@ func (ms *MessageStore) GetDecodedMessagesPaged(chatJID string, beforeTimestamp
 		}
 
 		// Populate Content for frontend rendering
-		msg.Content = ms.buildDecodedContent(chatJID, text.String, msg.ReplyToMessageID, fileName.String, msg.Type)
+		msg.Content = ms.buildDecodedContent(chatJID, msg.Info.ID, ms.RenderText(text.String, decodeMentions(mentions.String)), msg.ReplyToMessageID, fileName.String, msg.Type)
 
 		messages = append(messages, msg)
 	}
@@ -1049,7 +1314,7 @@ func (ms *MessageStore) GetDecodedMessagesPaged(chatJID string, beforeTimestamp
 
 // buildDecodedContent creates a DecodedMessageContent from DecodedMessage fields
 func (ms *MessageStore) buildDecodedContent(
-	chatJID, text, replyToMessageId, fileName string,
+	chatJID, messageID, text, replyToMessageId, fileName string,
 	mediaType mtypes.MediaType,
 ) *DecodedMessageContent {
 	content := &DecodedMessageContent{}
@@ -1095,9 +1360,22 @@ func (ms *MessageStore) buildDecodedContent(
 			ContextInfo: contextInfo,
 		}
 	case mtypes.MediaTypeAudio:
-		content.AudioMessage = &MediaMessageContent{
+		content.AudioMessage = &AudioMessageContent{
 			ContextInfo: contextInfo,
 		}
+		audio, err := ms.getAudioInfo(messageID)
+		if err != nil {
+			log.Println("Failed to load audio info:", err)
+			break
+		}
+		content.AudioMessage.Seconds = audio.Seconds
+		content.AudioMessage.PTT = audio.PTT
+		if len(audio.Waveform) > 0 {
+			content.AudioMessage.Waveform = make([]int, len(audio.Waveform))
+			for i, v := range audio.Waveform {
+				content.AudioMessage.Waveform[i] = int(v)
+			}
+		}
 	case mtypes.MediaTypeDocument:
 		content.DocumentMessage = &DocumentMessageContent{
 			FileName:    fileName,
@@ -1123,7 +1401,10 @@ func (ms *MessageStore) GetDecodedMessage(chatJID string, messageID string) (*De
 		isFromMe          bool
 		replyTo           sql.NullString
 		edited, forwarded bool
+		deleted           bool
+		status            int
 		text              sql.NullString
+		mentions          sql.NullString
 		msgType           sql.NullInt32
 		fileName          sql.NullString
 	)
@@ -1135,9 +1416,12 @@ func (ms *MessageStore) GetDecodedMessage(chatJID string, messageID string) (*De
 			&timestamp,
 			&isFromMe,
 			&text,
+			&mentions,
 			&replyTo,
 			&edited,
 			&forwarded,
+			&deleted,
+			&status,
 			&msgType,
 			&fileName,
 		)
@@ -1157,6 +1441,9 @@ func (ms *MessageStore) GetDecodedMessage(chatJID string, messageID string) (*De
 		Type:             mtypes.MediaType(msgType.Int32),
 		Edited:           edited,
 		Forwarded:        forwarded,
+		Deleted:          deleted,
+		Status:           decodedStatus(isFromMe, status),
+		Text:             text.String,
 		ReplyToMessageID: replyTo.String,
 		Info: DecodedMessageInfo{
 			ID:        messageID,
@@ -1175,7 +1462,7 @@ func (ms *MessageStore) GetDecodedMessage(chatJID string, messageID string) (*De
 	}
 
 	// Populate Content for frontend rendering
-	msg.Content = ms.buildDecodedContent(chatJID, text.String, msg.ReplyToMessageID, fileName.String, msg.Type)
+	msg.Content = ms.buildDecodedContent(chatJID, msg.Info.ID, ms.RenderText(text.String, decodeMentions(mentions.String)), msg.ReplyToMessageID, fileName.String, msg.Type)
 
 	return &msg, nil
 }
@@ -1199,8 +1486,11 @@ func (ms *MessageStore) GetDecodedChatList() ([]DecodedMessage, error) {
 			timestamp         int64
 			isFromMe          bool
 			text              sql.NullString
+			mentions          sql.NullString
 			replyTo           sql.NullString
 			edited, forwarded bool
+			deleted           bool
+			status            int
 			msgType           sql.NullInt32
 			fileName          sql.NullString
 		)
@@ -1212,9 +1502,12 @@ func (ms *MessageStore) GetDecodedChatList() ([]DecodedMessage, error) {
 			&timestamp,
 			&isFromMe,
 			&text,
+			&mentions,
 			&replyTo,
 			&edited,
 			&forwarded,
+			&deleted,
+			&status,
 			&msgType,
 			&fileName,
 		)
@@ -1227,6 +1520,9 @@ func (ms *MessageStore) GetDecodedChatList() ([]DecodedMessage, error) {
 			Type:             mtypes.MediaType(msgType.Int32),
 			Edited:           edited,
 			Forwarded:        forwarded,
+			Deleted:          deleted,
+			Status:           decodedStatus(isFromMe, status),
+			Text:             text.String,
 			ReplyToMessageID: replyTo.String,
 			Info: DecodedMessageInfo{
 				ID:        messageId,
@@ -1239,7 +1535,7 @@ func (ms *MessageStore) GetDecodedChatList() ([]DecodedMessage, error) {
 		}
 
 		// Populate Content for frontend rendering
-		msg.Content = ms.buildDecodedContent(chat, text.String, msg.ReplyToMessageID, fileName.String, msg.Type)
+		msg.Content = ms.buildDecodedContent(chat, msg.Info.ID, ms.RenderText(text.String, decodeMentions(mentions.String)), msg.ReplyToMessageID, fileName.String, msg.Type)
 
 		messages = append(messages, msg)
 	}
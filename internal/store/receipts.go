@@ -0,0 +1,160 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/lugvitc/whats4linux/internal/query"
+	"go.mau.fi/whatsmeow/proto/waWeb"
+	"go.mau.fi/whatsmeow/store"
+	"go.mau.fi/whatsmeow/types"
+)
+
+// MessageStatus is the aggregate delivery state of one of our messages
+type MessageStatus uint8
+
+const (
+	MessageStatusPending MessageStatus = iota
+	MessageStatusSent
+	MessageStatusDelivered
+	MessageStatusRead
+	MessageStatusPlayed
+)
+
+var messageStatusNames = [...]string{
+	MessageStatusPending:   "pending",
+	MessageStatusSent:      "sent",
+	MessageStatusDelivered: "delivered",
+	MessageStatusRead:      "read",
+	MessageStatusPlayed:    "played",
+}
+
+func (s MessageStatus) String() string {
+	if int(s) < len(messageStatusNames) {
+		return messageStatusNames[s]
+	}
+	return messageStatusNames[MessageStatusPending]
+}
+
+// MessageStatusFromWeb converts the status of a history sync message
+func MessageStatusFromWeb(status waWeb.WebMessageInfo_Status) MessageStatus {
+	if status <= waWeb.WebMessageInfo_PENDING {
+		return MessageStatusPending
+	}
+	return MessageStatus(status - waWeb.WebMessageInfo_PENDING)
+}
+
+// initialStatus is the status of a message when it gets stored, our own
+// messages are acknowledged by the server by then
+func initialStatus(isFromMe bool) MessageStatus {
+	if isFromMe {
+		return MessageStatusSent
+	}
+	return MessageStatusPending
+}
+
+// decodedStatus returns the status shown for a message, only our own
+// messages have one
+func decodedStatus(isFromMe bool, status int) string {
+	if !isFromMe {
+		return ""
+	}
+	return MessageStatus(status).String()
+}
+
+// MessageReceipt is the delivery state of a message for a single recipient,
+// timestamps are zero until the state is reached
+type MessageReceipt struct {
+	RecipientJID string `json:"recipient_jid"`
+	DeliveredAt  int64  `json:"delivered_at"`
+	ReadAt       int64  `json:"read_at"`
+	PlayedAt     int64  `json:"played_at"`
+}
+
+// AddReceipts stores a receipt sent by recipient for some of our messages and
+// updates their aggregate status. recipients is the number of recipients a
+// message has: 1 outside of groups, the participant count minus us in groups.
+// It returns the new status of every stored message.
+func (ms *MessageStore) AddReceipts(
+	ctx context.Context, sd store.LIDStore,
+	recipient types.JID, messageIDs []string,
+	status MessageStatus, timestamp time.Time, recipients int,
+) (map[string]MessageStatus, error) {
+	if status < MessageStatusDelivered {
+		return nil, nil
+	}
+	updateCanonicalJID(ctx, sd, &recipient)
+	if recipients < 1 {
+		recipients = 1
+	}
+
+	// every state implies the ones before it
+	ts := timestamp.Unix()
+	var deliveredAt, readAt, playedAt any
+	deliveredAt = ts
+	if status >= MessageStatusRead {
+		readAt = ts
+	}
+	if status >= MessageStatusPlayed {
+		playedAt = ts
+	}
+
+	statuses := make(map[string]MessageStatus, len(messageIDs))
+	err := ms.runSync(func(tx *sql.Tx) error {
+		for _, id := range messageIDs {
+			_, err := tx.Exec(query.UpsertMessageReceipt,
+				id,
+				recipient.ToNonAD().String(),
+				deliveredAt,
+				readAt,
+				playedAt,
+			)
+			if err != nil {
+				return err
+			}
+
+			var newStatus int
+			err = tx.QueryRow(query.UpdateMessageStatusFromReceipts, id, recipients).Scan(&newStatus)
+			if errors.Is(err, sql.ErrNoRows) {
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			statuses[id] = MessageStatus(newStatus)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return statuses, nil
+}
+
+// GetMessageReceipts returns the per recipient delivery state of a message
+func (ms *MessageStore) GetMessageReceipts(chatJID, messageID string) ([]MessageReceipt, error) {
+	rows, err := ms.db.Query(query.SelectMessageReceipts, chatJID, messageID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	receipts := []MessageReceipt{}
+	for rows.Next() {
+		var (
+			receipt                       MessageReceipt
+			deliveredAt, readAt, playedAt sql.NullInt64
+		)
+		err := rows.Scan(&receipt.RecipientJID, &deliveredAt, &readAt, &playedAt)
+		if err != nil {
+			return nil, err
+		}
+		receipt.DeliveredAt = deliveredAt.Int64
+		receipt.ReadAt = readAt.Int64
+		receipt.PlayedAt = playedAt.Int64
+		receipts = append(receipts, receipt)
+	}
+	return receipts, rows.Err()
+}
@@ -0,0 +1,163 @@
+package store
+
+import (
+	"database/sql"
+	"html"
+	"log"
+	"regexp"
+	"strings"
+
+	"github.com/lugvitc/whats4linux/internal/markdown"
+	"github.com/lugvitc/whats4linux/internal/query"
+	"go.mau.fi/whatsmeow/proto/waE2E"
+	"go.mau.fi/whatsmeow/types"
+)
+
+// MentionNameFunc returns the name shown for a mentioned user
+type MentionNameFunc func(jid types.JID) string
+
+// SetMentionNames sets how mentions are named when rendering messages,
+// mentions show the number of the user until it's set
+func (ms *MessageStore) SetMentionNames(fn MentionNameFunc) {
+	ms.mentionName = fn
+}
+
+// RenderText renders the raw text of a message as HTML, formatted with
+// WhatsApp's markdown dialect and with mentions replaced by names
+func (ms *MessageStore) RenderText(text string, mentions []string) string {
+	if text == "" {
+		return ""
+	}
+	rendered := markdown.MarkdownLinesToHTML(text)
+
+	for _, mentioned := range mentions {
+		jid, err := types.ParseJID(mentioned)
+		if err != nil {
+			continue
+		}
+		name := jid.User
+		if ms.mentionName != nil {
+			if n := ms.mentionName(jid); n != "" {
+				name = n
+			}
+		}
+		mentionHTML := `<span class="mention">@` + html.EscapeString(name) + `</span>`
+		rendered = strings.ReplaceAll(rendered, "@"+jid.User, mentionHTML)
+	}
+	return rendered
+}
+
+// RenderMessage renders the text of a message, or the caption of media, see
+// RenderText
+func (ms *MessageStore) RenderMessage(msg *waE2E.Message) string {
+	text, _, _, _, _, _, _, _ := extractMessageContent(msg)
+	return ms.RenderText(text, extractMentions(msg))
+}
+
+// extractMentions returns the JIDs mentioned in the text or caption of a message
+func extractMentions(msg *waE2E.Message) []string {
+	var contextInfo *waE2E.ContextInfo
+	switch {
+	case msg.GetExtendedTextMessage() != nil:
+		contextInfo = msg.GetExtendedTextMessage().GetContextInfo()
+	case msg.GetImageMessage() != nil:
+		contextInfo = msg.GetImageMessage().GetContextInfo()
+	case msg.GetVideoMessage() != nil:
+		contextInfo = msg.GetVideoMessage().GetContextInfo()
+	case msg.GetDocumentMessage() != nil:
+		contextInfo = msg.GetDocumentMessage().GetContextInfo()
+	}
+	return contextInfo.GetMentionedJID()
+}
+
+// mentions are stored comma separated in messages.mentions
+
+func encodeMentions(mentions []string) string {
+	return strings.Join(mentions, ",")
+}
+
+func decodeMentions(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(s, ",")
+}
+
+var (
+	mentionSpanRegex    = regexp.MustCompile(`<span class="mention">(.*?)</span>`)
+	inlineCodeSpanRegex = regexp.MustCompile(`<span class="inline-code">(.*?)</span>`)
+	renderedTagReplacer = strings.NewReplacer(
+		"<p>", "", "</p>", "\n",
+		"<br>", "\n",
+		"<blockquote>", "> ", "</blockquote>", "\n",
+		"<ul>", "", "</ul>", "",
+		"<li>", "- ", "</li>", "\n",
+		"<b>", "*", "</b>", "*",
+		"<i>", "_", "</i>", "_",
+		"<s>", "~", "</s>", "~",
+	)
+)
+
+// renderedToText converts the HTML that used to be stored in messages.text
+// back into WhatsApp markdown. The users behind mentions weren't stored, they
+// are kept as "@name".
+func renderedToText(s string) string {
+	s = mentionSpanRegex.ReplaceAllString(s, "$1")
+	s = inlineCodeSpanRegex.ReplaceAllString(s, "`$1`")
+	s = renderedTagReplacer.Replace(s)
+	s = htmlTagRegex.ReplaceAllString(s, "")
+	return strings.TrimSuffix(html.UnescapeString(s), "\n")
+}
+
+// convertRenderedText rewrites the rendered HTML rows of a table as raw
+// text, see renderedToText
+func convertRenderedText(tx *sql.Tx, selectQuery, updateQuery string) error {
+	rows, err := tx.Query(selectQuery)
+	if err != nil {
+		return err
+	}
+
+	type rendered struct {
+		id   int64
+		text string
+	}
+	var converted []rendered
+	for rows.Next() {
+		var r rendered
+		if err := rows.Scan(&r.id, &r.text); err != nil {
+			rows.Close()
+			return err
+		}
+		r.text = renderedToText(r.text)
+		converted = append(converted, r)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	stmt, err := tx.Prepare(updateQuery)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	for _, r := range converted {
+		if _, err := stmt.Exec(r.text, r.id); err != nil {
+			return err
+		}
+	}
+	if len(converted) > 0 {
+		log.Printf("Converted %d rendered messages back to text\n", len(converted))
+	}
+	return nil
+}
+
+// migrateRenderedText converts messages and edits stored as HTML to raw text
+func migrateRenderedText(tx *sql.Tx) error {
+	err := convertRenderedText(tx, query.SelectRenderedMessages, query.UpdateMessageTextByRowID)
+	if err != nil {
+		return err
+	}
+	return convertRenderedText(tx, query.SelectRenderedMessageEdits, query.UpdateMessageEditText)
+}
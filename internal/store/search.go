@@ -0,0 +1,248 @@
+package store
+
+import (
+	"database/sql"
+	"html"
+	"log"
+	"regexp"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/lugvitc/whats4linux/internal/query"
+	mtypes "github.com/lugvitc/whats4linux/internal/types"
+)
+
+const (
+	snippetOpenMarker  = "\x02"
+	snippetCloseMarker = "\x03"
+
+	defaultSearchLimit = 50
+)
+
+// SearchFilters narrows down a full-text search. Zero values disable a filter.
+type SearchFilters struct {
+	ChatJID   string `json:"chat_jid,omitempty"`
+	SenderJID string `json:"sender_jid,omitempty"`
+	// After and Before are unix timestamps (inclusive)
+	After  int64 `json:"after,omitempty"`
+	Before int64 `json:"before,omitempty"`
+	// MediaType restricts hits to one media type, nil matches every type
+	MediaType *mtypes.MediaType `json:"media_type,omitempty"`
+	Limit     int               `json:"limit,omitempty"`
+	Offset    int               `json:"offset,omitempty"`
+}
+
+// SearchResult is a single ranked search hit
+type SearchResult struct {
+	Message DecodedMessage `json:"message"`
+	// Snippet is an HTML-escaped excerpt with matches wrapped in <mark>
+	Snippet string  `json:"snippet"`
+	Rank    float64 `json:"rank"`
+}
+
+var (
+	breakTagRegex = regexp.MustCompile(`(?i)<br\s*/?>|</p>|</li>|</blockquote>`)
+	htmlTagRegex  = regexp.MustCompile(`<[^>]*>`)
+)
+
+// htmlToPlainText converts rendered message HTML into plain text, used to
+// index messages stored before the raw text was kept
+func htmlToPlainText(s string) string {
+	s = breakTagRegex.ReplaceAllString(s, "\n")
+	s = htmlTagRegex.ReplaceAllString(s, "")
+	return strings.TrimSpace(html.UnescapeString(s))
+}
+
+// buildFTSQuery turns free-form user input into a safe FTS5 query where every
+// word is matched as a quoted prefix term
+func buildFTSQuery(input string) string {
+	words := strings.FieldsFunc(input, func(r rune) bool {
+		return unicode.IsSpace(r) || r == '"'
+	})
+	terms := make([]string, 0, len(words))
+	for _, w := range words {
+		terms = append(terms, `"`+w+`"*`)
+	}
+	return strings.Join(terms, " ")
+}
+
+// formatSnippet escapes a raw FTS5 snippet and converts the match markers to <mark> tags
+func formatSnippet(raw string) string {
+	s := html.EscapeString(raw)
+	s = strings.ReplaceAll(s, snippetOpenMarker, "<mark>")
+	return strings.ReplaceAll(s, snippetCloseMarker, "</mark>")
+}
+
+// indexMessageText (re)writes the search index entry of a message
+func indexMessageText(tx *sql.Tx, messageID, text string) error {
+	_, err := tx.Exec(query.DeleteMessageFTS, messageID)
+	if err != nil {
+		return err
+	}
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return nil
+	}
+	_, err = tx.Exec(query.InsertMessageFTS, text, messageID)
+	return err
+}
+
+// backfillSearchIndex indexes every message that is not in messages_fts yet
+func backfillSearchIndex(tx *sql.Tx) error {
+	rows, err := tx.Query(query.SelectMessagesMissingFTS)
+	if err != nil {
+		return err
+	}
+
+	type pending struct {
+		rowID int64
+		text  string
+	}
+	var missing []pending
+	for rows.Next() {
+		var p pending
+		if err := rows.Scan(&p.rowID, &p.text); err != nil {
+			rows.Close()
+			return err
+		}
+		missing = append(missing, p)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	if len(missing) == 0 {
+		return nil
+	}
+
+	stmt, err := tx.Prepare(query.InsertMessageFTSByRowID)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	for _, p := range missing {
+		plain := htmlToPlainText(p.text)
+		if plain == "" {
+			continue
+		}
+		if _, err := stmt.Exec(p.rowID, plain); err != nil {
+			return err
+		}
+	}
+	log.Printf("Backfilled search index with %d messages\n", len(missing))
+	return nil
+}
+
+// SearchMessages runs a full-text search over messages.db and returns hits
+// ordered by relevance
+func (ms *MessageStore) SearchMessages(input string, filters SearchFilters) ([]SearchResult, error) {
+	ftsQuery := buildFTSQuery(input)
+	if ftsQuery == "" {
+		return []SearchResult{}, nil
+	}
+
+	limit := filters.Limit
+	if limit <= 0 {
+		limit = defaultSearchLimit
+	}
+	mediaType := -1
+	if filters.MediaType != nil {
+		mediaType = int(*filters.MediaType)
+	}
+
+	rows, err := ms.db.Query(query.SearchMessages,
+		ftsQuery,
+		filters.ChatJID,
+		filters.SenderJID,
+		filters.After,
+		filters.Before,
+		mediaType,
+		limit,
+		filters.Offset,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	results := []SearchResult{}
+
+	for rows.Next() {
+		var (
+			msgId             string
+			chatJid           string
+			senderJid         string
+			timestamp         int64
+			isFromMe          bool
+			text              sql.NullString
+			mentions          sql.NullString
+			replyTo           sql.NullString
+			edited, forwarded bool
+			deleted           bool
+			status            int
+			msgType           sql.NullInt32
+			fileName          sql.NullString
+			snippet           sql.NullString
+			rank              float64
+		)
+
+		err := rows.Scan(
+			&msgId,
+			&chatJid,
+			&senderJid,
+			&timestamp,
+			&isFromMe,
+			&text,
+			&mentions,
+			&replyTo,
+			&edited,
+			&forwarded,
+			&deleted,
+			&status,
+			&msgType,
+			&fileName,
+			&snippet,
+			&rank,
+		)
+		if err != nil {
+			log.Println("Failed to scan search result:", err)
+			continue
+		}
+
+		msg := DecodedMessage{
+			Type:             mtypes.MediaType(msgType.Int32),
+			ReplyToMessageID: replyTo.String,
+			Edited:           edited,
+			Forwarded:        forwarded,
+			Deleted:          deleted,
+			Status:           decodedStatus(isFromMe, status),
+			Text:             text.String,
+			Info: DecodedMessageInfo{
+				ID:        msgId,
+				Timestamp: time.Unix(timestamp, 0).Format(time.RFC3339),
+				IsFromMe:  isFromMe,
+				PushName:  "",
+				Sender:    senderJid,
+				Chat:      chatJid,
+			},
+		}
+
+		reactions, err := ms.GetReactionsByMessageID(msgId)
+		if err == nil {
+			msg.Reactions = reactions
+		}
+
+		msg.Content = ms.buildDecodedContent(chatJid, msg.Info.ID, ms.RenderText(text.String, decodeMentions(mentions.String)), msg.ReplyToMessageID, fileName.String, msg.Type)
+
+		results = append(results, SearchResult{
+			Message: msg,
+			Snippet: formatSnippet(snippet.String),
+			Rank:    rank,
+		})
+	}
+
+	return results, rows.Err()
+}
@@ -0,0 +1,117 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/lugvitc/whats4linux/internal/query"
+	"go.mau.fi/whatsmeow/proto/waE2E"
+	"go.mau.fi/whatsmeow/store"
+	"go.mau.fi/whatsmeow/types"
+)
+
+// UnreadMessage is an incoming message we haven't sent a read receipt for
+type UnreadMessage struct {
+	ID        string
+	Sender    types.JID
+	Timestamp int64
+}
+
+// CanonicalJID returns the phone number JID of a LID when it is known, the
+// JID messages.db stores chats and senders under
+func CanonicalJID(ctx context.Context, sd store.LIDStore, jid types.JID) types.JID {
+	updateCanonicalJID(ctx, sd, &jid)
+	return jid
+}
+
+// isUnread reports whether a newly received message counts as unread
+func isUnread(info *types.MessageInfo, msg *waE2E.Message) bool {
+	if info.IsFromMe || info.Chat == types.StatusBroadcastJID {
+		return false
+	}
+	return msg.GetProtocolMessage() == nil && msg.GetReactionMessage() == nil
+}
+
+// GetUnreadCounts returns the number of unread messages of every chat that
+// has any, keyed by chat JID
+func (ms *MessageStore) GetUnreadCounts() (map[string]int, error) {
+	rows, err := ms.db.Query(query.SelectUnreadCounts)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	counts := make(map[string]int)
+	for rows.Next() {
+		var (
+			chat  string
+			count int
+		)
+		if err := rows.Scan(&chat, &count); err != nil {
+			return nil, err
+		}
+		counts[chat] = count
+	}
+	return counts, rows.Err()
+}
+
+// GetUnreadCount returns the number of unread messages of a chat
+func (ms *MessageStore) GetUnreadCount(chatJID string) (int, error) {
+	var count int
+	err := ms.db.QueryRow(query.SelectUnreadCountByChat, chatJID).Scan(&count)
+	return count, err
+}
+
+// GetUnreadMessages returns the unread messages of a chat, oldest first
+func (ms *MessageStore) GetUnreadMessages(chatJID string) ([]UnreadMessage, error) {
+	rows, err := ms.db.Query(query.SelectUnreadMessagesByChat, chatJID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var unread []UnreadMessage
+	for rows.Next() {
+		var (
+			msg    UnreadMessage
+			sender string
+		)
+		if err := rows.Scan(&msg.ID, &sender, &msg.Timestamp); err != nil {
+			return nil, err
+		}
+		msg.Sender, _ = types.ParseJID(sender)
+		unread = append(unread, msg)
+	}
+	return unread, rows.Err()
+}
+
+// MarkChatRead marks every message of a chat received up to the given unix
+// timestamp as read
+func (ms *MessageStore) MarkChatRead(chatJID string, until int64) error {
+	return ms.runSync(func(tx *sql.Tx) error {
+		_, err := tx.Exec(query.MarkChatRead, chatJID, until)
+		return err
+	})
+}
+
+// MarkMessagesRead marks some messages of a chat as read, used for the read
+// receipts our other devices send
+func (ms *MessageStore) MarkMessagesRead(chatJID string, messageIDs []string) error {
+	return ms.runSync(func(tx *sql.Tx) error {
+		for _, id := range messageIDs {
+			_, err := tx.Exec(query.MarkMessageRead, chatJID, id)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// MarkChatUnread flags the latest incoming message of a chat as unread
+func (ms *MessageStore) MarkChatUnread(chatJID string) error {
+	return ms.runSync(func(tx *sql.Tx) error {
+		_, err := tx.Exec(query.MarkLatestMessageUnread, chatJID)
+		return err
+	})
+}
@@ -0,0 +1,94 @@
+package wa
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/lugvitc/whats4linux/internal/query"
+)
+
+// MutedForever is the MutedUntil value of chats muted without an end
+const MutedForever = -1
+
+// ChatState holds the archive, pin and mute state of a chat
+type ChatState struct {
+	JID      string
+	Archived bool
+	// PinnedAt is the unix time the chat was pinned at, 0 when not pinned
+	PinnedAt int64
+	// MutedUntil is a unix timestamp, MutedForever or 0 when not muted
+	MutedUntil int64
+}
+
+// Pinned reports whether the chat is pinned
+func (cs ChatState) Pinned() bool {
+	return cs.PinnedAt != 0
+}
+
+// Muted reports whether the chat is muted at the given time
+func (cs ChatState) Muted(now time.Time) bool {
+	return cs.MutedUntil == MutedForever || cs.MutedUntil > now.Unix()
+}
+
+func (cw *AppDatabase) SetChatArchived(jid string, archived bool) error {
+	_, err := cw.db.Exec(query.UpsertChatArchived, jid, archived)
+	if err != nil {
+		return fmt.Errorf("failed to update archived state of %s: %w", jid, err)
+	}
+	return nil
+}
+
+// SetChatPinned pins a chat at the given unix time, 0 unpins it
+func (cw *AppDatabase) SetChatPinned(jid string, pinnedAt int64) error {
+	_, err := cw.db.Exec(query.UpsertChatPinned, jid, pinnedAt)
+	if err != nil {
+		return fmt.Errorf("failed to update pinned state of %s: %w", jid, err)
+	}
+	return nil
+}
+
+// SetChatMuted mutes a chat until the given unix time, see ChatState.MutedUntil
+func (cw *AppDatabase) SetChatMuted(jid string, mutedUntil int64) error {
+	_, err := cw.db.Exec(query.UpsertChatMuted, jid, mutedUntil)
+	if err != nil {
+		return fmt.Errorf("failed to update muted state of %s: %w", jid, err)
+	}
+	return nil
+}
+
+// FetchChatState returns the state of a chat, the zero state when it has none
+func (cw *AppDatabase) FetchChatState(jid string) (ChatState, error) {
+	cs := ChatState{JID: jid}
+	err := cw.db.QueryRow(query.SelectChatState, jid).Scan(&cs.JID, &cs.Archived, &cs.PinnedAt, &cs.MutedUntil)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return cs, fmt.Errorf("failed to query chat state of %s: %w", jid, err)
+	}
+	return cs, nil
+}
+
+// FetchChatStates returns the state of every chat that has one, keyed by JID
+func (cw *AppDatabase) FetchChatStates() (map[string]ChatState, error) {
+	rows, err := cw.db.Query(query.SelectAllChatStates)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query chat states: %w", err)
+	}
+	defer rows.Close()
+
+	states := make(map[string]ChatState)
+	for rows.Next() {
+		var cs ChatState
+		err := rows.Scan(&cs.JID, &cs.Archived, &cs.PinnedAt, &cs.MutedUntil)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan chat state row: %w", err)
+		}
+		states[cs.JID] = cs
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("row iteration error: %w", err)
+	}
+
+	return states, nil
+}
@@ -6,12 +6,21 @@ import (
 	"fmt"
 	"sync"
 
+	"github.com/lugvitc/whats4linux/internal/migration"
 	"github.com/lugvitc/whats4linux/internal/misc"
 	"github.com/lugvitc/whats4linux/internal/query"
 
 	"go.mau.fi/whatsmeow"
 )
 
+// appMigrations is the schema history of app.db, append only
+var appMigrations = []migration.Migration{
+	// 1: base schema
+	migration.Exec(query.CreateGroupsTable),
+	// 2: archive, pin and mute state
+	migration.Exec(query.CreateChatStatesTable),
+}
+
 type AppDatabase struct {
 	db  *sql.DB
 	mu  sync.Mutex
@@ -23,6 +32,11 @@ func NewAppDatabase(ctx context.Context) (*AppDatabase, error) {
 	if err != nil {
 		return nil, err
 	}
+	err = migration.Apply(db, "app.db", appMigrations)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
 	return &AppDatabase{
 		db:  db,
 		ctx: ctx,
@@ -30,12 +44,7 @@ func NewAppDatabase(ctx context.Context) (*AppDatabase, error) {
 }
 
 func (cw *AppDatabase) Initialise(client *whatsmeow.Client) error {
-	_, err := cw.db.Exec(query.CreateGroupsTable)
-	if err != nil {
-		return fmt.Errorf("failed to create whats4linux_groups table: %w", err)
-	}
-
-	err = cw.FetchAndStoreGroups(client)
+	err := cw.FetchAndStoreGroups(client)
 	if err != nil {
 		return fmt.Errorf("failed to fetch and store groups: %w", err)
 	}
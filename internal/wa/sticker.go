@@ -0,0 +1,123 @@
+package wa
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	"image/draw"
+
+	"github.com/lugvitc/whats4linux/internal/webp"
+)
+
+const (
+	// StickerSize is the width and height of stickers
+	StickerSize = 512
+	// MaxStickerSize is WhatsApp's size limit for static stickers
+	MaxStickerSize = 100 << 10
+)
+
+// StickerMetadata is embedded in stickers, phones show the pack and the
+// publisher of a sticker and suggest it for its emojis
+type StickerMetadata struct {
+	PackID    string   `json:"sticker-pack-id"`
+	PackName  string   `json:"sticker-pack-name"`
+	Publisher string   `json:"sticker-pack-publisher"`
+	Emojis    []string `json:"emojis,omitempty"`
+}
+
+// stickerResolutions are the resolutions tried in turn to fit a sticker in
+// MaxStickerSize, lower ones are scaled back up to StickerSize. Lossless
+// WebP can't fit photos and other noisy images at full resolution.
+var stickerResolutions = []int{StickerSize, 384, 256, 192, 128}
+
+// MakeSticker turns a PNG, JPEG or GIF image into a sticker: it's fit into
+// StickerSize x StickerSize, padded with transparency and encoded as WebP
+// within MaxStickerSize. Only the first frame of a GIF is kept.
+func MakeSticker(data []byte, meta StickerMetadata) ([]byte, error) {
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode image: %w", err)
+	}
+
+	exif, err := stickerExif(meta)
+	if err != nil {
+		return nil, err
+	}
+	for _, resolution := range stickerResolutions {
+		sticker, err := webp.Encode(stickerCanvas(img, resolution), webp.Options{
+			Exif:    exif,
+			MaxSize: MaxStickerSize,
+		})
+		if !errors.Is(err, webp.ErrTooLarge) {
+			return sticker, err
+		}
+	}
+	return nil, webp.ErrTooLarge
+}
+
+// stickerCanvas fits img into a transparent StickerSize square, at the given
+// resolution. Upscaling repeats pixels, which compresses to almost nothing.
+func stickerCanvas(img image.Image, resolution int) *image.NRGBA {
+	scaled := image.Image(resample(img, resolution))
+	if resolution != StickerSize {
+		scaled = resample(scaled, StickerSize)
+	}
+	canvas := image.NewNRGBA(image.Rect(0, 0, StickerSize, StickerSize))
+	offset := image.Pt((StickerSize-scaled.Bounds().Dx())/2, (StickerSize-scaled.Bounds().Dy())/2)
+	draw.Draw(canvas, scaled.Bounds().Add(offset), scaled, image.Point{}, draw.Src)
+	return canvas
+}
+
+// stickerExif builds the EXIF metadata WhatsApp reads stickers' packs from:
+// a TIFF header with a single entry, tag 0x5741, holding the metadata as JSON
+func stickerExif(meta StickerMetadata) ([]byte, error) {
+	if meta.PackID == "" {
+		// stickers of the same pack share its ID
+		h := sha256.Sum256([]byte(meta.PackName + "\x00" + meta.Publisher))
+		meta.PackID = hex.EncodeToString(h[:16])
+	}
+	js, err := json.Marshal(meta)
+	if err != nil {
+		return nil, err
+	}
+
+	exif := []byte{
+		'I', 'I', 0x2a, 0x00, // little endian TIFF
+		0x08, 0x00, 0x00, 0x00, // offset of the IFD
+		0x01, 0x00, // one entry
+		0x41, 0x57, // tag
+		0x07, 0x00, // undefined type
+		0x00, 0x00, 0x00, 0x00, // length of the JSON
+		0x16, 0x00, 0x00, 0x00, // offset of the JSON
+	}
+	binary.LittleEndian.PutUint32(exif[14:], uint32(len(js)))
+	return append(exif, js...), nil
+}
+
+// WebPSize returns the size of a WebP image from its header
+func WebPSize(data []byte) (width, height int, ok bool) {
+	if len(data) < 30 || string(data[:4]) != "RIFF" || string(data[8:12]) != "WEBP" {
+		return 0, 0, false
+	}
+	chunk := data[12:]
+	switch string(chunk[:4]) {
+	case "VP8X":
+		w := int(chunk[12]) | int(chunk[13])<<8 | int(chunk[14])<<16
+		h := int(chunk[15]) | int(chunk[16])<<8 | int(chunk[17])<<16
+		return w + 1, h + 1, true
+	case "VP8L":
+		bits := binary.LittleEndian.Uint32(chunk[9:13])
+		return int(bits&0x3fff) + 1, int(bits>>14&0x3fff) + 1, true
+	case "VP8 ":
+		// after the frame tag and start code
+		w := binary.LittleEndian.Uint16(chunk[14:16]) & 0x3fff
+		h := binary.LittleEndian.Uint16(chunk[16:18]) & 0x3fff
+		return int(w), int(h), true
+	}
+	return 0, 0, false
+}
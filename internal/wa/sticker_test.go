@@ -0,0 +1,37 @@
+package wa
+
+import (
+	"bytes"
+	"image"
+	"image/png"
+	"math/rand/v2"
+	"testing"
+)
+
+func TestMakeStickerNoise(t *testing.T) {
+	// noise doesn't fit losslessly at full resolution, the sticker has to be
+	// made at a lower one
+	r := rand.New(rand.NewPCG(1, 2))
+	img := image.NewNRGBA(image.Rect(0, 0, 800, 600))
+	for i := range img.Pix {
+		img.Pix[i] = uint8(r.Uint32())
+		if i%4 == 3 {
+			img.Pix[i] = 255
+		}
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+
+	sticker, err := MakeSticker(buf.Bytes(), StickerMetadata{PackName: "pack", Publisher: "me"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sticker) > MaxStickerSize {
+		t.Fatalf("sticker is %d bytes, want at most %d", len(sticker), MaxStickerSize)
+	}
+	if w, h, ok := WebPSize(sticker); !ok || w != StickerSize || h != StickerSize {
+		t.Fatalf("sticker is %dx%d, want %dx%d", w, h, StickerSize, StickerSize)
+	}
+}
@@ -0,0 +1,137 @@
+package wa
+
+import (
+	"bytes"
+	"image"
+	_ "image/gif"
+	"image/jpeg"
+	_ "image/png"
+	"mime"
+	"net/http"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+const (
+	// thumbnailSize is the longest side of the thumbnails sent along media,
+	// WhatsApp's own clients send previews about this size
+	thumbnailSize    = 100
+	thumbnailQuality = 60
+)
+
+// DetectMime returns the mime type of outgoing media, sniffed from its
+// content. The extension of fileName is used when the content is not
+// recognised, like for most office documents.
+func DetectMime(data []byte, fileName string) string {
+	detected := http.DetectContentType(data)
+	mimeType, _, err := mime.ParseMediaType(detected)
+	if err != nil {
+		mimeType = "application/octet-stream"
+	}
+
+	switch mimeType {
+	case "application/ogg":
+		// voice notes are opus in ogg
+		if bytes.Contains(data[:min(len(data), 512)], []byte("OpusHead")) {
+			return "audio/ogg; codecs=opus"
+		}
+		return "audio/ogg"
+	case "application/octet-stream", "text/plain", "application/zip":
+		// docx, xlsx and friends are zip files
+		if byExt := mime.TypeByExtension(filepath.Ext(fileName)); byExt != "" {
+			if t, _, err := mime.ParseMediaType(byExt); err == nil {
+				return t
+			}
+		}
+	}
+	return mimeType
+}
+
+// FileNameFor returns fileName, or a default name with an extension
+// matching the mime type when it is empty
+func FileNameFor(fileName, mimeType string) string {
+	if fileName = filepath.Base(fileName); fileName != "." && fileName != "/" {
+		return fileName
+	}
+	fileName = "document"
+	if exts, _ := mime.ExtensionsByType(mimeType); len(exts) > 0 {
+		fileName += exts[0]
+	}
+	return fileName
+}
+
+// ImageThumbnail decodes an image and returns its size and a small JPEG
+// preview of it. Only the formats of the standard library are decoded.
+func ImageThumbnail(data []byte) (thumbnail []byte, width, height int, err error) {
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, 0, 0, err
+	}
+	bounds := img.Bounds()
+	width, height = bounds.Dx(), bounds.Dy()
+
+	var buf bytes.Buffer
+	err = jpeg.Encode(&buf, scaleDown(img, thumbnailSize), &jpeg.Options{Quality: thumbnailQuality})
+	if err != nil {
+		return nil, 0, 0, err
+	}
+	return buf.Bytes(), width, height, nil
+}
+
+// scaleDown shrinks img so that its longest side is at most size
+func scaleDown(img image.Image, size int) image.Image {
+	bounds := img.Bounds()
+	if bounds.Dx() <= size && bounds.Dy() <= size {
+		return img
+	}
+	return resample(img, size)
+}
+
+// resample scales img so that its longest side is size. Each new pixel
+// averages the pixels it covers, or repeats the nearest one when scaling up.
+func resample(img image.Image, size int) *image.RGBA {
+	bounds := img.Bounds()
+	w, h := bounds.Dx(), bounds.Dy()
+
+	tw, th := size, h*size/w
+	if h > w {
+		tw, th = w*size/h, size
+	}
+	tw, th = max(tw, 1), max(th, 1)
+
+	scaled := image.NewRGBA(image.Rect(0, 0, tw, th))
+	for ty := range th {
+		y0, y1 := bounds.Min.Y+ty*h/th, bounds.Min.Y+max((ty+1)*h/th, ty*h/th+1)
+		for tx := range tw {
+			x0, x1 := bounds.Min.X+tx*w/tw, bounds.Min.X+max((tx+1)*w/tw, tx*w/tw+1)
+
+			var r, g, b, a, n uint64
+			for y := y0; y < y1; y++ {
+				for x := x0; x < x1; x++ {
+					pr, pg, pb, pa := img.At(x, y).RGBA()
+					r, g, b, a = r+uint64(pr), g+uint64(pg), b+uint64(pb), a+uint64(pa)
+					n++
+				}
+			}
+			i := scaled.PixOffset(tx, ty)
+			scaled.Pix[i+0] = uint8(r / n >> 8)
+			scaled.Pix[i+1] = uint8(g / n >> 8)
+			scaled.Pix[i+2] = uint8(b / n >> 8)
+			scaled.Pix[i+3] = uint8(a / n >> 8)
+		}
+	}
+	return scaled
+}
+
+// pdfPageRegex matches the page objects of a PDF, but not the /Pages tree
+var pdfPageRegex = regexp.MustCompile(`/Type\s*/Page[^s]`)
+
+// PDFPageCount returns the number of pages of a PDF, 0 when it can't tell.
+// Pages in compressed object streams aren't seen.
+func PDFPageCount(data []byte) int {
+	if !strings.HasPrefix(string(data[:min(len(data), 5)]), "%PDF") {
+		return 0
+	}
+	return len(pdfPageRegex.FindAllIndex(data, -1))
+}
@@ -0,0 +1,99 @@
+package wa
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+)
+
+// WaveformSamples is the number of samples of the waveform of voice notes
+const WaveformSamples = 64
+
+// opusSampleRate is the rate granule positions of Opus streams count at,
+// whatever the rate of the input was
+const opusSampleRate = 48000
+
+var errNotOpus = errors.New("not an ogg/opus file")
+
+// oggPackets splits an OGG stream into its packets. It also returns the
+// granule position of the last page, the number of samples in the stream.
+func oggPackets(data []byte) (packets [][]byte, granule int64, err error) {
+	var packet []byte
+	for len(data) > 0 {
+		if len(data) < 27 || !bytes.Equal(data[:4], []byte("OggS")) {
+			return nil, 0, errNotOpus
+		}
+		if pos := int64(binary.LittleEndian.Uint64(data[6:14])); pos != -1 {
+			granule = pos
+		}
+
+		segments := int(data[26])
+		if len(data) < 27+segments {
+			return nil, 0, errNotOpus
+		}
+		lacing := data[27 : 27+segments]
+		data = data[27+segments:]
+
+		for _, size := range lacing {
+			if len(data) < int(size) {
+				return nil, 0, errNotOpus
+			}
+			packet = append(packet, data[:size]...)
+			data = data[size:]
+			// packets end with a segment shorter than 255
+			if size < 255 {
+				packets = append(packets, packet)
+				packet = nil
+			}
+		}
+	}
+	return packets, granule, nil
+}
+
+// OpusVoiceInfo returns the duration of an OGG/Opus file in seconds and a
+// waveform of WaveformSamples values from 0 to 100, like the ones WhatsApp
+// draws voice notes with.
+//
+// The audio isn't decoded, the waveform follows the size of the Opus
+// packets instead. They are encoded at a variable bitrate, so louder and
+// busier parts take more bytes and silence very few.
+func OpusVoiceInfo(data []byte) (seconds uint32, waveform []byte, err error) {
+	packets, granule, err := oggPackets(data)
+	if err != nil {
+		return 0, nil, err
+	}
+	// the stream starts with the OpusHead and OpusTags headers
+	if len(packets) < 2 || len(packets[0]) < 19 || !bytes.HasPrefix(packets[0], []byte("OpusHead")) {
+		return 0, nil, errNotOpus
+	}
+	preSkip := int64(binary.LittleEndian.Uint16(packets[0][10:12]))
+	audio := packets[2:]
+
+	samples := max(granule-preSkip, 0)
+	seconds = uint32((samples + opusSampleRate/2) / opusSampleRate)
+
+	waveform = make([]byte, WaveformSamples)
+	if len(audio) == 0 {
+		return seconds, waveform, nil
+	}
+
+	levels := make([]int, WaveformSamples)
+	var peak int
+	for i := range levels {
+		// the packets falling into this sample, at least one
+		from := i * len(audio) / WaveformSamples
+		to := max((i+1)*len(audio)/WaveformSamples, from+1)
+
+		var total int
+		for _, p := range audio[from:min(to, len(audio))] {
+			total += len(p)
+		}
+		levels[i] = total / (to - from)
+		peak = max(peak, levels[i])
+	}
+
+	for i, level := range levels {
+		waveform[i] = byte(level * 100 / max(peak, 1))
+	}
+	return seconds, waveform, nil
+}
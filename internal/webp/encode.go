@@ -0,0 +1,303 @@
+// Package webp encodes images as lossless WebP. It implements the small part
+// of VP8L needed for stickers: the subtract green and predictor transforms,
+// LZ77 backward references and prefix coding, without color caches or meta
+// prefix codes.
+package webp
+
+import (
+	"encoding/binary"
+	"errors"
+	"image"
+	"image/draw"
+)
+
+const (
+	vp8lSignature = 0x2f
+
+	subtractGreenTransform = 2
+
+	numLiteralCodes  = 256
+	numLengthCodes   = 24
+	numDistanceCodes = 40
+	// distances up to distanceMapSize are codes of the 2D neighbourhood,
+	// plain distances are shifted above them
+	distanceMapSize = 120
+
+	minMatch = 3
+	maxMatch = 4096
+	hashBits = 16
+	maxQuant = 5
+	// maxCodeLength is the longest prefix code VP8L allows
+	maxCodeLength = 15
+	// maxDistance is the longest distance the 40 distance codes reach
+	maxDistance = 1<<20 - distanceMapSize
+)
+
+// ErrTooLarge is returned when the image can't be made to fit in
+// Options.MaxSize
+var ErrTooLarge = errors.New("webp: image doesn't fit in the size limit")
+
+// Options of Encode
+type Options struct {
+	// Exif is embedded in the file as its EXIF metadata
+	Exif []byte
+	// MaxSize is the size the file must fit in, in bytes. The colors are
+	// quantized more and more until it does. 0 disables it.
+	MaxSize int
+}
+
+// Encode encodes an image as a lossless WebP file
+func Encode(img image.Image, opts Options) ([]byte, error) {
+	bounds := img.Bounds()
+	if bounds.Dx() < 1 || bounds.Dy() < 1 || bounds.Dx() > 1<<14 || bounds.Dy() > 1<<14 {
+		return nil, errors.New("webp: invalid image size")
+	}
+
+	nrgba := image.NewNRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(nrgba, nrgba.Bounds(), img, bounds.Min, draw.Src)
+
+	for quant := 0; quant <= maxQuant; quant++ {
+		data := container(encodeVP8L(nrgba, quant), nrgba.Bounds(), opts.Exif)
+		if opts.MaxSize == 0 || len(data) <= opts.MaxSize {
+			return data, nil
+		}
+	}
+	return nil, ErrTooLarge
+}
+
+// container wraps a VP8L bitstream in a RIFF file, with a VP8X header when
+// there is EXIF metadata
+func container(vp8l []byte, bounds image.Rectangle, exif []byte) []byte {
+	var chunks []byte
+	if len(exif) > 0 {
+		vp8x := make([]byte, 10)
+		vp8x[0] = 0x10 | 0x08 // alpha and EXIF
+		putUint24(vp8x[4:], uint32(bounds.Dx()-1))
+		putUint24(vp8x[7:], uint32(bounds.Dy()-1))
+		chunks = appendChunk(chunks, "VP8X", vp8x)
+	}
+	chunks = appendChunk(chunks, "VP8L", vp8l)
+	if len(exif) > 0 {
+		chunks = appendChunk(chunks, "EXIF", exif)
+	}
+
+	out := make([]byte, 0, 12+len(chunks))
+	out = append(out, "RIFF"...)
+	out = binary.LittleEndian.AppendUint32(out, uint32(4+len(chunks)))
+	out = append(out, "WEBP"...)
+	return append(out, chunks...)
+}
+
+func appendChunk(b []byte, fourCC string, data []byte) []byte {
+	b = append(b, fourCC...)
+	b = binary.LittleEndian.AppendUint32(b, uint32(len(data)))
+	b = append(b, data...)
+	// chunks are padded to an even size
+	if len(data)%2 == 1 {
+		b = append(b, 0)
+	}
+	return b
+}
+
+func putUint24(b []byte, v uint32) {
+	b[0], b[1], b[2] = byte(v), byte(v>>8), byte(v>>16)
+}
+
+// token is a literal pixel, or a backward reference when length is set
+type token struct {
+	argb     uint32
+	length   int
+	distance int
+}
+
+// encodeVP8L encodes an image as a VP8L bitstream, dropping the quant low
+// bits of the color channels. Alpha is kept exact, quantizing it would make
+// opaque images translucent.
+func encodeVP8L(img *image.NRGBA, quant int) []byte {
+	width, height := img.Bounds().Dx(), img.Bounds().Dy()
+	pixels := make([]uint32, 0, width*height)
+	mask := uint8(0xff << quant)
+	for y := range height {
+		for x := range width {
+			c := img.NRGBAAt(x, y)
+			r, g, b, a := c.R&mask, c.G&mask, c.B&mask, c.A
+			if a == 0 {
+				// invisible, make them all alike
+				r, g, b = 0, 0, 0
+			}
+			// subtract green transform
+			r, b = r-g, b-g
+			pixels = append(pixels, uint32(a)<<24|uint32(r)<<16|uint32(g)<<8|uint32(b))
+		}
+	}
+
+	residuals, modes, modesWidth := predict(pixels, width, height)
+
+	w := &bitWriter{}
+	w.write(vp8lSignature, 8)
+	w.write(uint32(width-1), 14)
+	w.write(uint32(height-1), 14)
+	w.write(1, 1) // alpha is used
+	w.write(0, 3) // version
+
+	// the decoder undoes the transforms in reverse order
+	w.write(1, 1)
+	w.write(subtractGreenTransform, 2)
+	w.write(1, 1)
+	w.write(predictorTransform, 2)
+	w.write(predictorBits, 3)
+	w.writeImage(modes, modesWidth, false)
+	w.write(0, 1) // no more transforms
+
+	w.writeImage(residuals, width, true)
+	return w.bytes()
+}
+
+// writeImage entropy codes an image, either the main image or the sub-image
+// of a transform
+func (w *bitWriter) writeImage(pixels []uint32, width int, main bool) {
+	tokens := backwardReferences(pixels, width)
+
+	// histograms of the five alphabets
+	green := make([]int, numLiteralCodes+numLengthCodes)
+	red := make([]int, numLiteralCodes)
+	blue := make([]int, numLiteralCodes)
+	alpha := make([]int, numLiteralCodes)
+	dist := make([]int, numDistanceCodes)
+	for _, t := range tokens {
+		if t.length > 0 {
+			code, _, _ := prefixEncode(t.length)
+			green[numLiteralCodes+code]++
+			code, _, _ = prefixEncode(t.distance + distanceMapSize)
+			dist[code]++
+			continue
+		}
+		alpha[t.argb>>24]++
+		red[t.argb>>16&0xff]++
+		green[t.argb>>8&0xff]++
+		blue[t.argb&0xff]++
+	}
+	codes := [5]huffmanCode{
+		newHuffmanCode(green, maxCodeLength),
+		newHuffmanCode(red, maxCodeLength),
+		newHuffmanCode(blue, maxCodeLength),
+		newHuffmanCode(alpha, maxCodeLength),
+		newHuffmanCode(dist, maxCodeLength),
+	}
+
+	w.write(0, 1) // no color cache
+	if main {
+		w.write(0, 1) // no meta prefix codes
+	}
+	for _, h := range codes {
+		w.writeHuffmanCode(h)
+	}
+
+	for _, t := range tokens {
+		if t.length > 0 {
+			code, bits, extra := prefixEncode(t.length)
+			codes[0].writeSymbol(w, numLiteralCodes+code)
+			w.write(extra, bits)
+			code, bits, extra = prefixEncode(t.distance + distanceMapSize)
+			codes[4].writeSymbol(w, code)
+			w.write(extra, bits)
+			continue
+		}
+		codes[0].writeSymbol(w, int(t.argb>>8&0xff))
+		codes[1].writeSymbol(w, int(t.argb>>16&0xff))
+		codes[2].writeSymbol(w, int(t.argb&0xff))
+		codes[3].writeSymbol(w, int(t.argb>>24))
+	}
+}
+
+// backwardReferences turns pixels into literals and greedy LZ77 matches
+// against the previous pixel, the pixel above and the last position with
+// the same two pixels
+func backwardReferences(pixels []uint32, width int) []token {
+	var tokens []token
+	head := make([]int32, 1<<hashBits)
+	for i := range head {
+		head[i] = -1
+	}
+	hash := func(i int) int {
+		h := (pixels[i]*0x9e3779b1 ^ pixels[i+1]*0x85ebca6b) >> (32 - hashBits)
+		return int(h)
+	}
+	matchLength := func(i, j int) int {
+		n := 0
+		for i+n < len(pixels) && n < maxMatch && pixels[i+n] == pixels[j+n] {
+			n++
+		}
+		return n
+	}
+
+	for i := 0; i < len(pixels); {
+		bestLen, bestDist := 0, 0
+		candidates := [3]int{i - 1, i - width, -1}
+		if i+1 < len(pixels) {
+			candidates[2] = int(head[hash(i)])
+		}
+		for _, j := range candidates {
+			if j < 0 || j >= i || i-j > maxDistance {
+				continue
+			}
+			if n := matchLength(i, j); n > bestLen {
+				bestLen, bestDist = n, i-j
+			}
+		}
+
+		step := 1
+		if bestLen >= minMatch {
+			tokens = append(tokens, token{length: bestLen, distance: bestDist})
+			step = bestLen
+		} else {
+			tokens = append(tokens, token{argb: pixels[i]})
+		}
+		for k := i; k < i+step && k+1 < len(pixels); k++ {
+			head[hash(k)] = int32(k)
+		}
+		i += step
+	}
+	return tokens
+}
+
+// prefixEncode splits a length or distance code of VP8L into its prefix
+// symbol and extra bits
+func prefixEncode(v int) (code int, bits uint, extra uint32) {
+	d := v - 1
+	if d < 2 {
+		return d, 0, 0
+	}
+	highest := 0
+	for d>>(highest+1) > 0 {
+		highest++
+	}
+	second := d >> (highest - 1) & 1
+	bits = uint(highest - 1)
+	return 2*highest + second, bits, uint32(d & (1<<bits - 1))
+}
+
+// bitWriter writes bits LSB first
+type bitWriter struct {
+	buf []byte
+	acc uint64
+	n   uint
+}
+
+func (w *bitWriter) write(v uint32, bits uint) {
+	w.acc |= uint64(v) << w.n
+	w.n += bits
+	for w.n >= 8 {
+		w.buf = append(w.buf, byte(w.acc))
+		w.acc >>= 8
+		w.n -= 8
+	}
+}
+
+func (w *bitWriter) bytes() []byte {
+	if w.n > 0 {
+		w.buf = append(w.buf, byte(w.acc))
+		w.acc, w.n = 0, 0
+	}
+	return w.buf
+}
@@ -0,0 +1,204 @@
+package webp
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"math/rand/v2"
+	"testing"
+
+	xwebp "golang.org/x/image/webp"
+)
+
+// testImage returns an image with a gradient, a repeated pattern and noise,
+// to go through the predictors and the backward references. alpha gives the
+// alpha of each pixel.
+func testImage(width, height int, seed uint64, alpha func(r *rand.Rand, x, y int) uint8) *image.NRGBA {
+	r := rand.New(rand.NewPCG(seed, seed))
+	img := image.NewNRGBA(image.Rect(0, 0, width, height))
+	for y := range height {
+		for x := range width {
+			var c color.NRGBA
+			switch {
+			case y < height/3:
+				c = color.NRGBA{uint8(x * 255 / width), uint8(y * 3), uint8(x + y), 0}
+			case y < 2*height/3:
+				c = color.NRGBA{uint8(x % 7 * 30), uint8(x % 5 * 50), 200, 0}
+			default:
+				c = color.NRGBA{uint8(r.Uint32()), uint8(r.Uint32()), uint8(r.Uint32()), 0}
+			}
+			c.A = alpha(r, x, y)
+			img.SetNRGBA(x, y, c)
+		}
+	}
+	return img
+}
+
+var alphas = []struct {
+	name  string
+	alpha func(r *rand.Rand, x, y int) uint8
+}{
+	{"opaque", func(*rand.Rand, int, int) uint8 { return 255 }},
+	{"transparent", func(*rand.Rand, int, int) uint8 { return 0 }},
+	{"translucent", func(r *rand.Rand, _, _ int) uint8 { return uint8(r.Uint32()) }},
+	{"mixed", func(_ *rand.Rand, x, y int) uint8 { return []uint8{0, 1, 128, 254, 255}[(x/3+y)%5] }},
+}
+
+// decode decodes a WebP file with golang.org/x/image/webp
+func decode(t *testing.T, data []byte) *image.NRGBA {
+	t.Helper()
+	img, err := xwebp.Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("failed to decode: %v", err)
+	}
+	nrgba, ok := img.(*image.NRGBA)
+	if !ok {
+		t.Fatalf("decoded a %T, want *image.NRGBA", img)
+	}
+	return nrgba
+}
+
+// checkPixels compares a decoded image with the one encoded at quant
+func checkPixels(t *testing.T, want, got *image.NRGBA, quant int) {
+	t.Helper()
+	if got.Bounds().Size() != want.Bounds().Size() {
+		t.Fatalf("size is %v, want %v", got.Bounds().Size(), want.Bounds().Size())
+	}
+	mask := uint8(0xff << quant)
+	for y := range want.Bounds().Dy() {
+		for x := range want.Bounds().Dx() {
+			w := want.NRGBAAt(x, y)
+			w.R, w.G, w.B = w.R&mask, w.G&mask, w.B&mask
+			if w.A == 0 {
+				w.R, w.G, w.B = 0, 0, 0
+			}
+			if g := got.NRGBAAt(x, y); g != w {
+				t.Fatalf("pixel (%d, %d) is %v, want %v", x, y, g, w)
+			}
+		}
+	}
+}
+
+func TestEncodeRoundTrip(t *testing.T) {
+	sizes := []image.Point{{1, 1}, {2, 3}, {7, 5}, {16, 16}, {17, 33}, {100, 64}, {300, 200}}
+	for _, size := range sizes {
+		for _, a := range alphas {
+			for quant := 0; quant <= maxQuant; quant++ {
+				img := testImage(size.X, size.Y, uint64(size.X*size.Y), a.alpha)
+				data := container(encodeVP8L(img, quant), img.Bounds(), nil)
+				t.Run(fmt.Sprintf("%v/%s/quant%d", size, a.name, quant), func(t *testing.T) {
+					checkPixels(t, img, decode(t, data), quant)
+				})
+			}
+		}
+	}
+}
+
+func TestEncodeSticker(t *testing.T) {
+	img := testImage(512, 512, 1, alphas[3].alpha)
+	data, err := Encode(img, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkPixels(t, img, decode(t, data), 0)
+}
+
+func TestEncodeFlat(t *testing.T) {
+	// a single color makes single symbol prefix codes
+	img := image.NewNRGBA(image.Rect(0, 0, 64, 48))
+	for i := range img.Pix {
+		img.Pix[i] = 0x80
+	}
+	data, err := Encode(img, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkPixels(t, img, decode(t, data), 0)
+}
+
+func TestEncodeMaxSize(t *testing.T) {
+	img := testImage(256, 256, 7, alphas[0].alpha)
+	full, err := Encode(img, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// forces quantization, which must leave the image opaque
+	data, err := Encode(img, Options{MaxSize: len(full) - 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(data) >= len(full) {
+		t.Fatalf("size is %d, want less than %d", len(data), len(full))
+	}
+	got := decode(t, data)
+	for i := 3; i < len(got.Pix); i += 4 {
+		if got.Pix[i] != 255 {
+			t.Fatalf("alpha is %d, want 255", got.Pix[i])
+		}
+	}
+
+	_, err = Encode(img, Options{MaxSize: 100})
+	if !errors.Is(err, ErrTooLarge) {
+		t.Fatalf("err is %v, want ErrTooLarge", err)
+	}
+}
+
+func TestEncodeExif(t *testing.T) {
+	img := testImage(40, 30, 3, alphas[2].alpha)
+	exif := []byte("II*\x00exif payload")
+	data, err := Encode(img, Options{Exif: exif})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	chunks := map[string][]byte{}
+	var order []string
+	for b := data[12:]; len(b) >= 8; {
+		fourCC, size := string(b[:4]), int(binary.LittleEndian.Uint32(b[4:8]))
+		chunks[fourCC] = b[8 : 8+size]
+		order = append(order, fourCC)
+		b = b[8+size+size%2:]
+	}
+	if got := len(order); got != 3 || order[0] != "VP8X" || order[1] != "VP8L" || order[2] != "EXIF" {
+		t.Fatalf("chunks are %v, want [VP8X VP8L EXIF]", order)
+	}
+	if flags := chunks["VP8X"][0]; flags != 0x18 {
+		t.Errorf("VP8X flags are %#x, want alpha and EXIF", flags)
+	}
+	if !bytes.Equal(chunks["EXIF"], exif) {
+		t.Errorf("EXIF is %q, want %q", chunks["EXIF"], exif)
+	}
+	if got := binary.LittleEndian.Uint32(data[4:8]); int(got) != len(data)-8 {
+		t.Errorf("RIFF size is %d, want %d", got, len(data)-8)
+	}
+
+	// x/image doesn't take VP8L with the alpha flag of VP8X, decode the
+	// bitstream alone
+	checkPixels(t, img, decode(t, container(chunks["VP8L"], img.Bounds(), nil)), 0)
+}
+
+func TestHuffmanLengthLimit(t *testing.T) {
+	// Fibonacci counts make the deepest Huffman trees
+	counts := make([]int, 40)
+	a, b := 1, 1
+	for i := range counts {
+		counts[i] = a
+		a, b = b, a+b
+	}
+	h := newHuffmanCode(counts, maxCodeLength)
+
+	kraft := 0
+	for sym, l := range h.lengths {
+		if l == 0 || int(l) > maxCodeLength {
+			t.Fatalf("symbol %d has length %d", sym, l)
+		}
+		kraft += 1 << (maxCodeLength - l)
+	}
+	if kraft != 1<<maxCodeLength {
+		t.Fatalf("code is not complete, Kraft sum is %d/%d", kraft, 1<<maxCodeLength)
+	}
+}
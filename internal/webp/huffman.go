@@ -0,0 +1,166 @@
+package webp
+
+import "sort"
+
+// huffmanCode is a canonical prefix code of a VP8L alphabet
+type huffmanCode struct {
+	// lengths are the code lengths written in the header
+	lengths []uint8
+	// codes are bit-reversed, as the bit writer puts the LSB first
+	codes []uint16
+	// single is set when only one symbol is used, it's then written with no
+	// bits at all
+	single bool
+}
+
+// newHuffmanCode builds a prefix code from the counts of the symbols of an
+// alphabet, with codes no longer than limit bits
+func newHuffmanCode(counts []int, limit int) huffmanCode {
+	h := huffmanCode{
+		lengths: make([]uint8, len(counts)),
+		codes:   make([]uint16, len(counts)),
+	}
+
+	var used []int
+	for sym, c := range counts {
+		if c > 0 {
+			used = append(used, sym)
+		}
+	}
+	// an unused alphabet still needs a valid code
+	if len(used) == 0 {
+		used = []int{0}
+	}
+	if len(used) == 1 {
+		h.lengths[used[0]] = 1
+		h.single = true
+		return h
+	}
+
+	weights := make([]int, len(counts))
+	copy(weights, counts)
+	for minCount := 1; ; minCount *= 2 {
+		// flattening the distribution shortens the longest codes
+		for _, sym := range used {
+			weights[sym] = max(weights[sym], minCount)
+		}
+		if huffmanLengths(weights, used, h.lengths) <= limit {
+			break
+		}
+	}
+
+	// canonical codes, in the order of the lengths then of the symbols
+	var blCount [16]int
+	for _, l := range h.lengths {
+		blCount[l]++
+	}
+	blCount[0] = 0
+	var nextCode [16]int
+	code := 0
+	for bits := 1; bits < 16; bits++ {
+		code = (code + blCount[bits-1]) << 1
+		nextCode[bits] = code
+	}
+	for sym, l := range h.lengths {
+		if l == 0 {
+			continue
+		}
+		h.codes[sym] = reverseBits(uint16(nextCode[l]), l)
+		nextCode[l]++
+	}
+	return h
+}
+
+// huffmanLengths sets the code lengths of the used symbols from a Huffman
+// tree of their weights and returns the longest one
+func huffmanLengths(weights []int, used []int, lengths []uint8) int {
+	type node struct {
+		weight      int
+		sym         int
+		left, right int
+	}
+
+	nodes := make([]node, 0, 2*len(used))
+	for _, sym := range used {
+		nodes = append(nodes, node{weight: weights[sym], sym: sym, left: -1, right: -1})
+	}
+	sort.SliceStable(nodes, func(i, j int) bool {
+		return nodes[i].weight < nodes[j].weight
+	})
+
+	// two queues: the sorted leaves, then the merged nodes, which are
+	// created in increasing weight order
+	leaf, merged := 0, len(nodes)
+	pop := func() int {
+		if leaf < len(used) && (merged >= len(nodes) || nodes[leaf].weight <= nodes[merged].weight) {
+			leaf++
+			return leaf - 1
+		}
+		merged++
+		return merged - 1
+	}
+	for range len(used) - 1 {
+		a, b := pop(), pop()
+		nodes = append(nodes, node{weight: nodes[a].weight + nodes[b].weight, sym: -1, left: a, right: b})
+	}
+
+	longest := 0
+	var walk func(i, depth int)
+	walk = func(i, depth int) {
+		if nodes[i].sym >= 0 {
+			lengths[nodes[i].sym] = uint8(depth)
+			longest = max(longest, depth)
+			return
+		}
+		walk(nodes[i].left, depth+1)
+		walk(nodes[i].right, depth+1)
+	}
+	walk(len(nodes)-1, 0)
+	return longest
+}
+
+func reverseBits(code uint16, n uint8) uint16 {
+	var r uint16
+	for range n {
+		r = r<<1 | code&1
+		code >>= 1
+	}
+	return r
+}
+
+// writeSymbol writes the code of a symbol
+func (h *huffmanCode) writeSymbol(w *bitWriter, sym int) {
+	if h.single {
+		return
+	}
+	w.write(uint32(h.codes[sym]), uint(h.lengths[sym]))
+}
+
+// codeLengthOrder is the order the lengths of the code length code are
+// written in
+var codeLengthOrder = [19]int{17, 18, 0, 1, 2, 3, 4, 5, 16, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15}
+
+// writeHuffmanCode writes a prefix code as a "normal" code of VP8L. The code
+// lengths are written literally, without the repeat codes 16 to 18.
+func (w *bitWriter) writeHuffmanCode(h huffmanCode) {
+	counts := make([]int, len(codeLengthOrder))
+	for _, l := range h.lengths {
+		counts[l]++
+	}
+	lengthCode := newHuffmanCode(counts, 7)
+
+	n := len(codeLengthOrder)
+	for n > 4 && lengthCode.lengths[codeLengthOrder[n-1]] == 0 {
+		n--
+	}
+
+	w.write(0, 1) // normal code
+	w.write(uint32(n-4), 4)
+	for _, sym := range codeLengthOrder[:n] {
+		w.write(uint32(lengthCode.lengths[sym]), 3)
+	}
+	w.write(0, 1) // lengths of every symbol follow
+	for _, l := range h.lengths {
+		lengthCode.writeSymbol(w, int(l))
+	}
+}
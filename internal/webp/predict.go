@@ -0,0 +1,153 @@
+package webp
+
+const (
+	predictorTransform = 0
+	// predictorBits sets the size of the blocks sharing a predictor, 16x16
+	predictorBits  = 2
+	numPredictors  = 14
+	blackPredictor = 0xff000000
+)
+
+// predict applies the predictor transform to pixels. Every block picks the
+// predictor leaving the smallest residuals, and pixels are replaced by their
+// difference from the prediction. It returns the predictor of each block.
+func predict(pixels []uint32, width, height int) (residuals, modes []uint32, modesWidth int) {
+	blockSize := 1 << (predictorBits + 2)
+	modesWidth = (width + blockSize - 1) / blockSize
+	modesHeight := (height + blockSize - 1) / blockSize
+	modes = make([]uint32, modesWidth*modesHeight)
+	residuals = make([]uint32, len(pixels))
+
+	for by := range modesHeight {
+		for bx := range modesWidth {
+			best, bestCost := 0, -1
+			for mode := range numPredictors {
+				cost := 0
+				forBlock(bx, by, blockSize, width, height, func(x, y int) {
+					i := y*width + x
+					cost += residualCost(sub(pixels[i], prediction(pixels, i, x, y, width, mode)))
+				})
+				if bestCost < 0 || cost < bestCost {
+					best, bestCost = mode, cost
+				}
+			}
+
+			modes[by*modesWidth+bx] = blackPredictor | uint32(best)<<8
+			forBlock(bx, by, blockSize, width, height, func(x, y int) {
+				i := y*width + x
+				residuals[i] = sub(pixels[i], prediction(pixels, i, x, y, width, best))
+			})
+		}
+	}
+	return residuals, modes, modesWidth
+}
+
+func forBlock(bx, by, blockSize, width, height int, fn func(x, y int)) {
+	for y := by * blockSize; y < min((by+1)*blockSize, height); y++ {
+		for x := bx * blockSize; x < min((bx+1)*blockSize, width); x++ {
+			fn(x, y)
+		}
+	}
+}
+
+// prediction returns the prediction of the pixel i at (x, y) with a
+// predictor mode. The top row and left column have fixed predictors.
+func prediction(pixels []uint32, i, x, y, width, mode int) uint32 {
+	switch {
+	case x == 0 && y == 0:
+		return blackPredictor
+	case y == 0:
+		return pixels[i-1]
+	case x == 0:
+		return pixels[i-width]
+	}
+
+	// the top right of the last column is the first pixel of the row,
+	// which is where it is in memory anyway
+	l, t, tl, tr := pixels[i-1], pixels[i-width], pixels[i-width-1], pixels[i-width+1]
+	switch mode {
+	case 0:
+		return blackPredictor
+	case 1:
+		return l
+	case 2:
+		return t
+	case 3:
+		return tr
+	case 4:
+		return tl
+	case 5:
+		return average2(average2(l, tr), t)
+	case 6:
+		return average2(l, tl)
+	case 7:
+		return average2(l, t)
+	case 8:
+		return average2(tl, t)
+	case 9:
+		return average2(t, tr)
+	case 10:
+		return average2(average2(l, tl), average2(t, tr))
+	case 11:
+		return selectPredictor(l, t, tl)
+	case 12:
+		return channelwise(l, t, tl, func(a, b, c int) int { return a + b - c })
+	default:
+		return channelwise(average2(l, t), tl, 0, func(a, b, _ int) int { return a + (a-b)/2 })
+	}
+}
+
+func channel(p uint32, shift int) int {
+	return int(p >> shift & 0xff)
+}
+
+func average2(a, b uint32) uint32 {
+	return (((a ^ b) & 0xfefefefe) >> 1) + (a & b)
+}
+
+// channelwise applies fn to each channel, clamping the results to 0..255
+func channelwise(a, b, c uint32, fn func(a, b, c int) int) uint32 {
+	var p uint32
+	for shift := 0; shift < 32; shift += 8 {
+		v := min(max(fn(channel(a, shift), channel(b, shift), channel(c, shift)), 0), 255)
+		p |= uint32(v) << shift
+	}
+	return p
+}
+
+func selectPredictor(l, t, tl uint32) uint32 {
+	var pl, pt int
+	for shift := 0; shift < 32; shift += 8 {
+		estimate := channel(l, shift) + channel(t, shift) - channel(tl, shift)
+		pl += abs(estimate - channel(l, shift))
+		pt += abs(estimate - channel(t, shift))
+	}
+	if pl < pt {
+		return l
+	}
+	return t
+}
+
+// sub subtracts each channel of b from a, modulo 256
+func sub(a, b uint32) uint32 {
+	alphaGreen := 0x00ff00ff + (a & 0xff00ff00) - (b & 0xff00ff00)
+	redBlue := 0xff00ff00 + (a & 0x00ff00ff) - (b & 0x00ff00ff)
+	return alphaGreen&0xff00ff00 | redBlue&0x00ff00ff
+}
+
+// residualCost estimates how many bits a residual takes, small values in
+// either direction are cheap
+func residualCost(r uint32) int {
+	cost := 0
+	for shift := 0; shift < 32; shift += 8 {
+		cost += abs(int(int8(r >> shift)))
+	}
+	return cost
+}
+
+func abs(v int) int {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
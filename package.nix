@@ -93,7 +93,7 @@ buildGoModule {
     export HOME=$(mktemp -d)
     
     # Build with Wails using buildGoModule's vendoring
-    wails build -s -tags "webkit2_41,soup_3"
+    wails build -s -tags "webkit2_41,soup_3,sqlite_fts5"
   '';
 
   buildPhase = "runHook preBuild"; # no `go build`
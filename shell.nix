@@ -103,7 +103,7 @@ pkgs.mkShell {
     # echo "LDFLAGS set to: $LDFLAGS"
     # echo "HOME set to: $HOME"
     echo -e "Available commands:"
-    echo -e "  Development build:$GREEN wails build -s -tags \"webkit2_41,soup_3\"$NC (uses buildGoModule vendoring)"
+    echo -e "  Development build:$GREEN wails build -s -tags \"webkit2_41,soup_3,sqlite_fts5\"$NC (uses buildGoModule vendoring)"
     echo -e "  Nix package build:$GREEN build-nix$NC (reproducible build)"
   '';
 }